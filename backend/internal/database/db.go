@@ -1,10 +1,14 @@
 package database
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"strings"
 
+	"github.com/GridexX/qr-tracker/internal/utils"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 	_ "modernc.org/sqlite"
 )
@@ -20,6 +24,15 @@ func Initialize() (*sql.DB, error) {
 		databaseURL = strings.Replace(databaseURL, "sqlite://", "file:", 1)
 	}
 
+	// Local databases wait for locks instead of failing concurrent scans
+	if strings.HasPrefix(databaseURL, "file:") && !strings.Contains(databaseURL, "busy_timeout") {
+		separator := "?"
+		if strings.Contains(databaseURL, "?") {
+			separator = "&"
+		}
+		databaseURL += separator + "_pragma=busy_timeout(5000)"
+	}
+
 	db, err := sql.Open("libsql", databaseURL)
 	if err != nil {
 		return nil, err
@@ -29,9 +42,44 @@ func Initialize() (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	key, err := ipHashKey(db)
+	if err != nil {
+		return nil, fmt.Errorf("IP hash key: %v", err)
+	}
+	utils.SetIPHashKey(key)
+
 	return db, nil
 }
 
+// ipHashKey returns the key IP addresses are hashed with: IP_HASH_SECRET,
+// or a random key generated on first start and kept in the database, so
+// hashes match across restarts and instances
+func ipHashKey(db *sql.DB) ([]byte, error) {
+	if secret := os.Getenv("IP_HASH_SECRET"); secret != "" {
+		return []byte(secret), nil
+	}
+
+	fresh := make([]byte, 32)
+	if _, err := rand.Read(fresh); err != nil {
+		return nil, err
+	}
+	// Another instance may have stored a key already; keep theirs
+	if _, err := db.Exec("INSERT OR IGNORE INTO secrets (name, value) VALUES ('ip_hash_key', ?)",
+		hex.EncodeToString(fresh)); err != nil {
+		return nil, err
+	}
+
+	var encoded string
+	if err := db.QueryRow("SELECT value FROM secrets WHERE name = 'ip_hash_key'").Scan(&encoded); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(encoded)
+}
+
 func createTables(db *sql.DB) error {
 	queries := []string{
 		`CREATE TABLE IF NOT EXISTS qr_codes (
@@ -60,6 +108,105 @@ func createTables(db *sql.DB) error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_qr_scans_qr_code_id ON qr_scans(qr_code_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_qr_scans_scanned_at ON qr_scans(scanned_at)`,
+		`CREATE TABLE IF NOT EXISTS qr_redirect_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			qr_code_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			field TEXT NOT NULL,
+			value TEXT NOT NULL,
+			target_url TEXT NOT NULL,
+			FOREIGN KEY (qr_code_id) REFERENCES qr_codes (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_qr_redirect_rules_qr_code_id ON qr_redirect_rules(qr_code_id, position)`,
+		`CREATE TABLE IF NOT EXISTS qr_schedules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			qr_code_id INTEGER NOT NULL,
+			starts_at DATETIME,
+			ends_at DATETIME,
+			target_url TEXT NOT NULL,
+			FOREIGN KEY (qr_code_id) REFERENCES qr_codes (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_qr_schedules_qr_code_id ON qr_schedules(qr_code_id)`,
+		`CREATE TABLE IF NOT EXISTS qr_variants (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			qr_code_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			target_url TEXT NOT NULL,
+			weight INTEGER NOT NULL DEFAULT 1,
+			FOREIGN KEY (qr_code_id) REFERENCES qr_codes (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_qr_variants_qr_code_id ON qr_variants(qr_code_id)`,
+		`CREATE TABLE IF NOT EXISTS qr_conversions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			scan_id INTEGER NOT NULL,
+			qr_code_id INTEGER NOT NULL,
+			variant_id INTEGER,
+			event TEXT NOT NULL,
+			value REAL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (qr_code_id) REFERENCES qr_codes (id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_qr_conversions_qr_code_id ON qr_conversions(qr_code_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_qr_conversions_variant_id ON qr_conversions(variant_id)`,
+		`CREATE TABLE IF NOT EXISTS custom_domains (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hostname TEXT UNIQUE NOT NULL,
+			is_default BOOLEAN DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS qr_code_domains (
+			qr_code_id INTEGER NOT NULL,
+			domain_id INTEGER NOT NULL,
+			PRIMARY KEY (qr_code_id, domain_id),
+			FOREIGN KEY (qr_code_id) REFERENCES qr_codes (id),
+			FOREIGN KEY (domain_id) REFERENCES custom_domains (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS bulk_jobs (
+			id TEXT PRIMARY KEY,
+			status TEXT NOT NULL DEFAULT 'running',
+			total INTEGER NOT NULL,
+			completed INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			finished_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL COLLATE NOCASE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS qr_code_tags (
+			qr_code_id INTEGER NOT NULL,
+			tag_id INTEGER NOT NULL,
+			PRIMARY KEY (qr_code_id, tag_id),
+			FOREIGN KEY (qr_code_id) REFERENCES qr_codes (id),
+			FOREIGN KEY (tag_id) REFERENCES tags (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS folders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			parent_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (parent_id) REFERENCES folders (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS scan_rollups (
+			qr_code_id INTEGER NOT NULL,
+			day TEXT NOT NULL,
+			dimension TEXT NOT NULL,
+			value TEXT NOT NULL,
+			scans INTEGER NOT NULL DEFAULT 0,
+			unique_scans INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (qr_code_id, day, dimension, value)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_scan_rollups_dimension ON scan_rollups(dimension, day)`,
+		`CREATE TABLE IF NOT EXISTS visitor_salts (
+			day TEXT PRIMARY KEY,
+			salt TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS secrets (
+			name TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`,
 	}
 
 	for _, query := range queries {
@@ -70,3 +217,192 @@ func createTables(db *sql.DB) error {
 
 	return nil
 }
+
+// column describes a column added to an existing table after its initial
+// CREATE TABLE, so databases created by older versions get upgraded.
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+var columns = []column{
+	{"qr_scans", "visitor_hash", "TEXT"},
+	{"qr_codes", "retention_days", "INTEGER"},
+	{"qr_codes", "analytics_sinks", "TEXT"},
+	{"qr_codes", "utm_source", "TEXT"},
+	{"qr_codes", "utm_medium", "TEXT"},
+	{"qr_codes", "utm_campaign", "TEXT"},
+	{"qr_codes", "utm_term", "TEXT"},
+	{"qr_codes", "utm_content", "TEXT"},
+	{"qr_codes", "timezone", "TEXT"},
+	{"qr_codes", "expires_at", "DATETIME"},
+	{"qr_codes", "expired_url", "TEXT"},
+	{"qr_codes", "track_conversions", "BOOLEAN DEFAULT 0"},
+	{"qr_codes", "access_mode", "TEXT DEFAULT 'open'"},
+	{"qr_codes", "password_hash", "TEXT"},
+	{"qr_codes", "max_scans", "INTEGER"},
+	{"qr_codes", "redirect_count", "INTEGER DEFAULT 0"},
+	{"qr_codes", "status", "TEXT NOT NULL DEFAULT 'active'"},
+	{"qr_scans", "event_type", "TEXT NOT NULL DEFAULT 'redirect'"},
+	{"qr_codes", "deleted_at", "DATETIME"},
+	{"qr_codes", "domain_id", "INTEGER REFERENCES custom_domains (id)"},
+	{"qr_codes", "quarantine_reason", "TEXT"},
+	{"qr_codes", "payload_type", "TEXT DEFAULT 'url'"},
+	{"qr_codes", "payload", "TEXT"},
+	{"qr_codes", "dynamic", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"qr_codes", "bulk_job_id", "TEXT REFERENCES bulk_jobs (id)"},
+	{"qr_codes", "folder_id", "INTEGER REFERENCES folders (id)"},
+	{"qr_codes", "metadata", "TEXT"},
+	{"qr_scans", "os", "TEXT"},
+	{"qr_scans", "rule_id", "INTEGER"},
+	{"qr_scans", "variant_id", "INTEGER"},
+	{"qr_scans", "is_bot", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"qr_scans", "referrer", "TEXT"},
+}
+
+// backfills fill in a column for the rows that existed before it was
+// added, keyed by table and column name. They run in the transaction that
+// adds the column.
+var backfills = map[string]func(tx *sql.Tx) error{
+	"qr_scans.is_bot": backfillBots,
+}
+
+// backfillBots flags the scans recorded before bot detection by their user
+// agent. Private scans have none stored and are left as people.
+func backfillBots(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT DISTINCT user_agent FROM qr_scans WHERE user_agent IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	var bots []string
+	for rows.Next() {
+		var userAgent string
+		if err := rows.Scan(&userAgent); err != nil {
+			rows.Close()
+			return err
+		}
+		if utils.IsBot(userAgent) {
+			bots = append(bots, userAgent)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userAgent := range bots {
+		if _, err := tx.Exec("UPDATE qr_scans SET is_bot = 1 WHERE user_agent = ?", userAgent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_qr_scans_variant_id ON qr_scans(variant_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_scans_visitor_hash ON qr_scans(qr_code_id, visitor_hash)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_codes_domain_id ON qr_codes(domain_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_code_domains_domain_id ON qr_code_domains(domain_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_codes_bulk_job_id ON qr_codes(bulk_job_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_codes_folder_id ON qr_codes(folder_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_code_tags_tag_id ON qr_code_tags(tag_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders(parent_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_qr_scans_history ON qr_scans(qr_code_id, scanned_at, id)`,
+}
+
+// uniqueIndex is a unique index added to an existing table. Rows that
+// would break it are deleted first, keeping the oldest of each duplicate.
+type uniqueIndex struct {
+	name    string
+	table   string
+	columns string
+}
+
+var uniqueIndexes = []uniqueIndex{
+	{"idx_qr_conversions_scan_event", "qr_conversions", "scan_id, event"},
+}
+
+func migrate(db *sql.DB) error {
+	for _, col := range columns {
+		exists, err := columnExists(db, col.table, col.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err := addColumn(db, col); err != nil {
+			return err
+		}
+	}
+
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range uniqueIndexes {
+		var exists int
+		err := db.QueryRow("SELECT 1 FROM sqlite_master WHERE type = 'index' AND name = ?", index.name).Scan(&exists)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		dedupe := fmt.Sprintf("DELETE FROM %s WHERE id NOT IN (SELECT MIN(id) FROM %s GROUP BY %s)", index.table, index.table, index.columns)
+		if _, err := db.Exec(dedupe); err != nil {
+			return err
+		}
+		query := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s(%s)", index.name, index.table, index.columns)
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumn adds a column to its table and runs its backfill, if any
+func addColumn(db *sql.DB, col column) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.name, col.definition)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if backfill, ok := backfills[col.table+"."+col.name]; ok {
+		if err := backfill(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func columnExists(db *sql.DB, table, name string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var colName, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if colName == name {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
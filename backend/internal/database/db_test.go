@@ -0,0 +1,86 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateBackfillsBots(t *testing.T) {
+	db, err := sql.Open("libsql", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Scans recorded before bot detection, private ones without a user agent
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	userAgents := []interface{}{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15",
+		"Googlebot/2.1 (+http://www.google.com/bot.html)",
+		"curl/8.4.0",
+		"",
+		nil,
+	}
+	for _, userAgent := range userAgents {
+		if _, err := db.Exec("INSERT INTO qr_scans (qr_code_id, user_agent) VALUES (1, ?)", userAgent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []bool{false, true, true, true, false}
+	rows, err := db.Query("SELECT is_bot FROM qr_scans ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for i := 0; rows.Next(); i++ {
+		var bot bool
+		if err := rows.Scan(&bot); err != nil {
+			t.Fatal(err)
+		}
+		if bot != want[i] {
+			t.Errorf("is_bot of %q = %v, want %v", userAgents[i], bot, want[i])
+		}
+	}
+}
+
+func TestIPHashKey(t *testing.T) {
+	path := "file:" + filepath.Join(t.TempDir(), "test.db")
+	t.Setenv("DATABASE_URL", path)
+	t.Setenv("IP_HASH_SECRET", "")
+	t.Setenv("JWT_SECRET", "jwt-secret")
+
+	keys := make([][]byte, 2)
+	for i := range keys {
+		db, err := Initialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i], err = ipHashKey(db)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys[0]) != 32 || !bytes.Equal(keys[0], keys[1]) {
+		t.Errorf("generated keys %x and %x, want the same 32 bytes", keys[0], keys[1])
+	}
+
+	t.Setenv("IP_HASH_SECRET", "ip-secret")
+	db, err := Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if key, err := ipHashKey(db); err != nil || string(key) != "ip-secret" {
+		t.Errorf("key %q, %v, want IP_HASH_SECRET", key, err)
+	}
+}
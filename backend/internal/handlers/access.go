@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Access modes of a QR code
+const (
+	accessOpen     = "open"
+	accessPassword = "password"
+	accessMaxScans = "max_scans"
+	accessOneTime  = "one_time"
+)
+
+// passwordFormPage asks for the password of a protected QR code. It posts
+// back to the redirect URL it was served from.
+const passwordFormPage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Password required</title>
+    <style>
+        body { font-family: sans-serif; max-width: 20rem; margin: 4rem auto; padding: 0 1rem; }
+        input, button { width: 100%; padding: 0.5rem; margin-top: 0.5rem; box-sizing: border-box; }
+        .error { color: #b00020; }
+    </style>
+</head>
+<body>
+    <h1>Password required</h1>
+    <form method="post">
+        {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+        <input type="password" name="password" autocomplete="current-password" required autofocus>
+        <button type="submit">Continue</button>
+    </form>
+</body>
+</html>`
+
+var passwordForm = template.Must(template.New("password").Parse(passwordFormPage))
+
+// hashAccessPassword hashes the password of a protected QR code for storage
+func hashAccessPassword(password string) (sql.NullString, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(hash), Valid: true}, nil
+}
+
+// checkAccessPassword guards a password protected QR code. It reports
+// whether the client posted the right password; otherwise the password
+// form has been served.
+func (h *Handler) checkAccessPassword(c *gin.Context, qrID int) bool {
+	if c.Request.Method != http.MethodPost {
+		renderPasswordForm(c, http.StatusOK, "")
+		return false
+	}
+
+	var hash sql.NullString
+	err := h.db.QueryRow("SELECT password_hash FROM qr_codes WHERE id = ?", qrID).Scan(&hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !hash.Valid || bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(c.PostForm("password"))) != nil {
+		renderPasswordForm(c, http.StatusUnauthorized, "Incorrect password")
+		return false
+	}
+	return true
+}
+
+func renderPasswordForm(c *gin.Context, status int, message string) {
+	var page bytes.Buffer
+	if err := passwordForm.Execute(&page, gin.H{"Error": message}); err != nil {
+		log.Printf("Error rendering password form: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render password form"})
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
+
+// scanLimit returns how many times a QR code may redirect, 0 meaning
+// without limit
+func scanLimit(qr models.QRCode) int {
+	switch qr.AccessMode {
+	case accessOneTime:
+		return 1
+	case accessMaxScans:
+		if qr.MaxScans != nil {
+			return *qr.MaxScans
+		}
+	}
+	return 0
+}
+
+// consumeRedirect counts a successful redirect and reports false if the
+// code has used up its limit. Checking and counting happen in a single
+// UPDATE, so concurrent scans can never get past the limit.
+func (h *Handler) consumeRedirect(qr models.QRCode) (bool, error) {
+	limit := scanLimit(qr)
+	result, err := h.db.Exec(`UPDATE qr_codes SET redirect_count = redirect_count + 1
+		WHERE id = ? AND (? = 0 OR redirect_count < ?)`, qr.ID, limit, limit)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// serveGone answers scans of a code that no longer redirects: expired or
+// used up. They go to the code's expired URL or EXPIRED_REDIRECT_URL, or
+// get a 410.
+func serveGone(c *gin.Context, qr models.QRCode, message string) {
+	expiredURL := qr.ExpiredURL
+	if expiredURL == "" {
+		expiredURL = os.Getenv("EXPIRED_REDIRECT_URL")
+	}
+	if expiredURL != "" {
+		c.Redirect(http.StatusFound, expiredURL)
+		return
+	}
+	c.JSON(http.StatusGone, gin.H{"error": message})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/database"
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/safety"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// openTestDB creates an empty database in a temporary directory
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	db, err := database.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// insertTestQR stores a QR code with the given access mode and returns it
+func insertTestQR(t *testing.T, db *sql.DB, code, accessMode string, maxScans *int) models.QRCode {
+	t.Helper()
+	result, err := db.Exec(`INSERT INTO qr_codes (code, title, target_url, access_mode, max_scans)
+		VALUES (?, ?, 'https://example.com', ?, ?)`, code, code, accessMode, maxScans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return models.QRCode{ID: int(id), Code: code, AccessMode: accessMode, MaxScans: maxScans}
+}
+
+func TestConsumeRedirectConcurrentLimit(t *testing.T) {
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	five := 5
+
+	for _, tc := range []struct {
+		accessMode string
+		maxScans   *int
+		want       int
+	}{
+		{accessMaxScans, &five, 5},
+		{accessOneTime, nil, 1},
+		{accessOpen, nil, 40},
+	} {
+		t.Run(tc.accessMode, func(t *testing.T) {
+			qr := insertTestQR(t, db, "limit-"+tc.accessMode, tc.accessMode, tc.maxScans)
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			allowed := 0
+			for i := 0; i < 40; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := h.consumeRedirect(qr)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if ok {
+						mu.Lock()
+						allowed++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if allowed != tc.want {
+				t.Errorf("%d redirects allowed, want %d", allowed, tc.want)
+			}
+			var count int
+			db.QueryRow("SELECT redirect_count FROM qr_codes WHERE id = ?", qr.ID).Scan(&count)
+			if count != tc.want {
+				t.Errorf("redirect_count = %d, want %d", count, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsOmittedFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	db := openTestDB(t)
+	h := &Handler{db: db, safety: &safety.Policy{Schemes: []string{"https"}}}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	result, err := db.Exec(`INSERT INTO qr_codes (code, title, target_url, background_color, foreground_color, size,
+		retention_days, analytics_sinks, utm_source, expires_at, access_mode, password_hash)
+		VALUES ('keep', 'Poster', 'https://example.com', '#FFEEDD', '#112233', 512, 30, 'webhook', 'poster',
+		'2030-01-01 00:00:00', ?, ?)`, accessPassword, string(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(id, 10)}}
+	c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"title": "Renamed"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.UpdateQR(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var qr models.QRCode
+	if err := scanQRCode(db.QueryRow(`SELECT `+qrCodeColumns+` FROM qr_codes q WHERE q.id = ?`, id), &qr); err != nil {
+		t.Fatal(err)
+	}
+	var storedHash sql.NullString
+	db.QueryRow("SELECT password_hash FROM qr_codes WHERE id = ?", id).Scan(&storedHash)
+	if qr.Title != "Renamed" || qr.AccessMode != accessPassword || storedHash.String != string(hash) {
+		t.Errorf("title %q, access mode %q, password hash kept %v", qr.Title, qr.AccessMode, storedHash.String == string(hash))
+	}
+	if qr.TargetURL != "https://example.com" || qr.BackgroundColor != "#FFEEDD" || qr.ForegroundColor != "#112233" || qr.Size != 512 {
+		t.Errorf("target %q, colors %q %q, size %d", qr.TargetURL, qr.BackgroundColor, qr.ForegroundColor, qr.Size)
+	}
+	if qr.RetentionDays == nil || *qr.RetentionDays != 30 || len(qr.AnalyticsSinks) != 1 || qr.Source != "poster" ||
+		qr.ExpiresAt == nil || !qr.ExpiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("retention %v, sinks %v, utm_source %q, expires_at %v", qr.RetentionDays, qr.AnalyticsSinks, qr.Source, qr.ExpiresAt)
+	}
+	if _, err := os.Stat(filepath.Join("data", "qr_images", "keep.png")); err != nil {
+		t.Errorf("image not regenerated: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/gin-gonic/gin"
+)
+
+// breakdownDimension is how scans are grouped by a dimension: by the
+// expression scans on qr_scans, or by rollupValue on the counts of the
+// rollup dimension
+type breakdownDimension struct {
+	scans, rollup, rollupValue string
+}
+
+// breakdownDimensions maps the dimensions scans can be broken down by to
+// the SQL grouping them. Only these expressions ever reach the query.
+var breakdownDimensions = map[string]breakdownDimension{
+	"country":     {"COALESCE(NULLIF(country, ''), 'Unknown')", "country", "value"},
+	"city":        {"COALESCE(NULLIF(city, ''), 'Unknown')", "city", "value"},
+	"device_type": {"COALESCE(NULLIF(device_type, ''), 'Unknown')", "device_type", "value"},
+	"browser":     {"COALESCE(NULLIF(browser, ''), 'Unknown')", "browser", "value"},
+	"os":          {"COALESCE(NULLIF(os, ''), 'Unknown')", "os", "value"},
+	"referrer":    {"COALESCE(NULLIF(referrer, ''), 'Direct')", "referrer", "value"},
+	"hour_of_day": {"CAST(strftime('%H', scanned_at) AS INTEGER)", "hour", "CAST(value AS INTEGER)"},
+	"weekday":     {"CAST(strftime('%w', scanned_at) AS INTEGER)", rollups.Total, "CAST(strftime('%w', day) AS INTEGER)"},
+}
+
+const (
+	defaultBreakdownLimit = 10
+	maxBreakdownLimit     = 100
+)
+
+// GetBreakdown counts scans by the values of a dimension, with their share
+// of all scans. The limit most scanned values are listed and the rest are
+// summed up as other. hour_of_day (UTC) and weekday list every hour or day
+// in order instead.
+func (h *Handler) GetBreakdown(c *gin.Context) {
+	dimension := c.Query("dimension")
+	grouping, ok := breakdownDimensions[dimension]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dimension must be country, city, device_type, browser, os, referrer, hour_of_day or weekday"})
+		return
+	}
+
+	limit := defaultBreakdownLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxBreakdownLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxBreakdownLimit)})
+			return
+		}
+		limit = n
+	}
+
+	scope, args, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var filters []string
+	if qrID := c.Query("qr_id"); qrID != "" {
+		if !h.qrExists(c, qrID) {
+			return
+		}
+		filters = append(filters, "qr_code_id = ?")
+		args = append(args, qrID)
+	}
+
+	// Bounds on UTC midnights, or an end not before now, are counted from
+	// the rollups
+	type timeBound struct {
+		operator string
+		t        time.Time
+	}
+	var bounds []timeBound
+	daily := true
+	for _, bound := range []struct{ param, operator string }{{"from", ">="}, {"to", "<"}} {
+		t, err := parseScheduleTime(c.Query(bound.param), time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + ": " + err.Error()})
+			return
+		}
+		if t != nil {
+			if !t.Equal(bucketStart(t.UTC(), "day")) && (bound.param == "from" || t.Before(time.Now())) {
+				daily = false
+			}
+			bounds = append(bounds, timeBound{bound.operator, *t})
+		}
+	}
+	for _, bound := range bounds {
+		if daily {
+			day := bucketStart(bound.t.UTC(), "day")
+			if !day.Equal(bound.t) {
+				day = nextBucket(day, "day")
+			}
+			filters = append(filters, "day "+bound.operator+" ?")
+			args = append(args, day.Format("2006-01-02"))
+		} else {
+			filters = append(filters, "scanned_at "+bound.operator+" ?")
+			args = append(args, formatDBTime(&bound.t))
+		}
+	}
+
+	query := `SELECT ` + grouping.scans + ` AS value, COUNT(*) AS scans FROM qr_scans WHERE ` + rollups.Counted + ` AND ` + scopedScans(scope)
+	if daily {
+		query = `SELECT ` + grouping.rollupValue + ` AS value, SUM(scans) AS scans FROM ` + scanCounts(grouping.rollup, scope)
+	}
+	for _, filter := range filters {
+		query += " AND " + filter
+	}
+	query += " GROUP BY 1 ORDER BY scans DESC, value"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch breakdown"})
+		return
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	var values []models.BreakdownValue
+	for rows.Next() {
+		var value models.BreakdownValue
+		if err := rows.Scan(&value.Value, &value.Scans); err != nil {
+			continue
+		}
+		counts[value.Value] = value.Scans
+		values = append(values, value)
+	}
+
+	breakdown := models.Breakdown{Dimension: dimension, Values: []models.BreakdownValue{}}
+	for _, value := range values {
+		breakdown.TotalScans += value.Scans
+	}
+
+	switch dimension {
+	case "hour_of_day":
+		for hour := 0; hour < 24; hour++ {
+			breakdown.Values = append(breakdown.Values, models.BreakdownValue{Value: strconv.Itoa(hour), Scans: counts[strconv.Itoa(hour)]})
+		}
+	case "weekday":
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			breakdown.Values = append(breakdown.Values, models.BreakdownValue{Value: day.String(), Scans: counts[strconv.Itoa(int(day))]})
+		}
+	default:
+		for i, value := range values {
+			if i < limit {
+				breakdown.Values = append(breakdown.Values, value)
+				continue
+			}
+			if i == limit {
+				breakdown.Values = append(breakdown.Values, models.BreakdownValue{Value: "Other", Other: true})
+			}
+			breakdown.Values[limit].Scans += value.Scans
+		}
+	}
+
+	for i := range breakdown.Values {
+		breakdown.Values[i].Percentage = percentage(breakdown.Values[i].Scans, breakdown.TotalScans)
+	}
+
+	c.JSON(http.StatusOK, breakdown)
+}
+
+// percentage is part of total in percent, rounded to one decimal
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*1000/float64(total)) / 10
+}
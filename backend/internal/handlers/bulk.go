@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Statuses of a bulk job. Its QR codes exist as soon as it is created; the
+// job tracks the generation of their images.
+const (
+	bulkRunning = "running"
+	bulkDone    = "done"
+	bulkFailed  = "failed"
+)
+
+const (
+	defaultBulkMaxRows = 1000
+	maxBulkBodySize    = 10 << 20
+)
+
+// csvJSONColumns are the CSV columns holding something other than a
+// string. Their cells are JSON values.
+var csvJSONColumns = map[string]bool{
+	"size":              true,
+	"retention_days":    true,
+	"max_scans":         true,
+	"domain_id":         true,
+	"track_conversions": true,
+	"dynamic":           true,
+	"analytics_sinks":   true,
+	"payload":           true,
+	"tags":              true,
+	"folder_id":         true,
+	"metadata":          true,
+}
+
+// bulkMaxRows is the most QR codes one bulk request may create, set with
+// BULK_MAX_ROWS
+func bulkMaxRows() int {
+	if value := os.Getenv("BULK_MAX_ROWS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return defaultBulkMaxRows
+}
+
+// CreateQRBulk creates QR codes from a JSON array of create requests or a
+// CSV file with one request per row. Every row is validated before any is
+// inserted, and all of them are inserted in one transaction. Their images
+// are generated by a background job.
+func (h *Handler) CreateQRBulk(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBulkBodySize)
+	rows, err := readBulkRows(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No QR codes to create"})
+		return
+	}
+	if maxRows := bulkMaxRows(); len(rows) > maxRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d QR codes can be created at once", maxRows)})
+		return
+	}
+
+	jobID, err := generateJobID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create bulk job"})
+		return
+	}
+
+	// Validate every row before inserting any
+	var pending []*pendingQR
+	var rowErrors []models.BulkRowError
+	for i, row := range rows {
+		var req models.CreateQRRequest
+		err := row.err
+		if err == nil {
+			err = json.Unmarshal(row.data, &req)
+		}
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&req)
+		}
+		status := http.StatusBadRequest
+		var p *pendingQR
+		if err == nil {
+			p, status, err = h.prepareQRCode(&req)
+		}
+		if status == http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, models.BulkRowError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+		p.bulkJobID = sql.NullString{String: jobID, Valid: true}
+		pending = append(pending, p)
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Some rows are invalid, no QR codes were created", "errors": rowErrors})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO bulk_jobs (id, status, total) VALUES (?, ?, ?)", jobID, bulkRunning, len(pending)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create bulk job"})
+		return
+	}
+	job := models.BulkJob{ID: jobID, Status: bulkRunning, Total: len(pending), CreatedAt: time.Now()}
+	for _, p := range pending {
+		qrCode, err := insertQRCode(tx, p)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create QR codes"})
+			return
+		}
+		job.QRCodes = append(job.QRCodes, qrCode)
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create QR codes"})
+		return
+	}
+
+	go h.runBulkJob(jobID, job.QRCodes)
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetBulkJob reports the progress of a bulk job
+func (h *Handler) GetBulkJob(c *gin.Context) {
+	job, err := h.loadBulkJob(c.Param("job"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bulk job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch bulk job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// DownloadBulkJob streams a ZIP of the images of a finished bulk job, with
+// a codes.csv listing what each image encodes. Codes deleted since are left
+// out.
+func (h *Handler) DownloadBulkJob(c *gin.Context) {
+	jobID := c.Param("job")
+	job, err := h.loadBulkJob(jobID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bulk job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch bulk job"})
+		return
+	}
+	if job.Status == bulkRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": "Bulk job is still running", "completed": job.Completed, "total": job.Total})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT `+qrCodeColumns+` FROM qr_codes q
+							 WHERE q.bulk_job_id = ? AND q.deleted_at IS NULL ORDER BY q.id`, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR codes"})
+		return
+	}
+	defer rows.Close()
+
+	var qrCodes []models.QRCode
+	for rows.Next() {
+		var qr models.QRCode
+		if err := scanQRCode(rows, &qr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read QR code"})
+			return
+		}
+		qrCodes = append(qrCodes, qr)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="qr-codes-%s.zip"`, jobID))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	manifest, _ := archive.CreateHeader(&zip.FileHeader{Name: "codes.csv", Method: zip.Deflate, Modified: time.Now()})
+	list := csv.NewWriter(manifest)
+	list.Write([]string{"id", "code", "title", "content", "image"})
+	for _, qr := range qrCodes {
+		list.Write([]string{strconv.Itoa(qr.ID), qr.Code, qr.Title, qr.Content, qr.Code + ".png"})
+	}
+	list.Flush()
+
+	for _, qr := range qrCodes {
+		if err := addQRImage(archive, qr); err != nil {
+			log.Printf("Error adding QR code %s to bulk download: %v", qr.Code, err)
+			break
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Error writing bulk download %s: %v", jobID, err)
+	}
+}
+
+// ResumeBulkJobs restarts the image generation of bulk jobs interrupted by
+// a restart
+func (h *Handler) ResumeBulkJobs() {
+	rows, err := h.db.Query("SELECT id FROM bulk_jobs WHERE status = ?", bulkRunning)
+	if err != nil {
+		log.Printf("Error listing bulk jobs: %v", err)
+		return
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			jobIDs = append(jobIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, jobID := range jobIDs {
+		qrRows, err := h.db.Query(`SELECT `+qrCodeColumns+` FROM qr_codes q WHERE q.bulk_job_id = ? ORDER BY q.id`, jobID)
+		if err != nil {
+			log.Printf("Error resuming bulk job %s: %v", jobID, err)
+			continue
+		}
+		var qrCodes []models.QRCode
+		for qrRows.Next() {
+			var qr models.QRCode
+			if err := scanQRCode(qrRows, &qr); err == nil {
+				qrCodes = append(qrCodes, qr)
+			}
+		}
+		qrRows.Close()
+
+		log.Printf("Resuming bulk job %s", jobID)
+		go h.runBulkJob(jobID, qrCodes)
+	}
+}
+
+// runBulkJob generates the images of the QR codes of a bulk job, counting
+// its progress as it goes
+func (h *Handler) runBulkJob(jobID string, qrCodes []models.QRCode) {
+	var failed []string
+	for i, qr := range qrCodes {
+		if err := writeQRImage(qr.Code, qr.Content, qr.Size); err != nil {
+			log.Printf("Error generating image of QR code %s: %v", qr.Code, err)
+			failed = append(failed, qr.Code)
+		}
+		if _, err := h.db.Exec("UPDATE bulk_jobs SET completed = ? WHERE id = ?", i+1, jobID); err != nil {
+			log.Printf("Error updating bulk job %s: %v", jobID, err)
+		}
+	}
+
+	status, message := bulkDone, sql.NullString{}
+	if len(failed) > 0 {
+		status = bulkFailed
+		message = sql.NullString{String: "Could not generate images of " + strings.Join(failed, ", "), Valid: true}
+	}
+	_, err := h.db.Exec("UPDATE bulk_jobs SET status = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?",
+		status, message, jobID)
+	if err != nil {
+		log.Printf("Error finishing bulk job %s: %v", jobID, err)
+	}
+}
+
+func (h *Handler) loadBulkJob(jobID string) (models.BulkJob, error) {
+	var job models.BulkJob
+	var message sql.NullString
+	var finishedAt sql.NullTime
+	err := h.db.QueryRow(`SELECT id, status, total, completed, error, created_at, finished_at
+						  FROM bulk_jobs WHERE id = ?`, jobID).
+		Scan(&job.ID, &job.Status, &job.Total, &job.Completed, &message, &job.CreatedAt, &finishedAt)
+	if err != nil {
+		return job, err
+	}
+	job.Error = message.String
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
+
+// addQRImage adds the PNG image of a QR code to a ZIP archive, rendering
+// it again if the file is missing
+func addQRImage(archive *zip.Writer, qr models.QRCode) error {
+	imagePath := fmt.Sprintf("./data/qr_images/%s.png", qr.Code)
+	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+		if err := writeQRImage(qr.Code, qr.Content, qr.Size); err != nil {
+			return err
+		}
+	}
+
+	image, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: qr.Code + ".png", Method: zip.Store, Modified: qr.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, image)
+	return err
+}
+
+// bulkRow is the JSON create request of a row of a bulk request, or why
+// it couldn't be read
+type bulkRow struct {
+	data json.RawMessage
+	err  error
+}
+
+// readBulkRows splits a bulk request into its rows. The body is a JSON
+// array, or CSV with Content-Type text/csv.
+func readBulkRows(r *http.Request) ([]bulkRow, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read request body: %v", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		return csvRows(body)
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("Body must be a JSON array of QR codes, or CSV with Content-Type text/csv")
+	}
+	rows := make([]bulkRow, len(items))
+	for i, item := range items {
+		rows[i].data = item
+	}
+	return rows, nil
+}
+
+// csvRows turns the rows of a CSV file into JSON create requests. The
+// header names the fields of each column as in the JSON API; the cells of
+// csvJSONColumns are JSON values and "payload.<field>" columns fill in the
+// string fields of the payload. Empty cells are left out.
+func csvRows(body []byte) ([]bulkRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	// Reject unknown columns once rather than on every row
+	header := records[0]
+	known := map[string]interface{}{}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if !strings.HasPrefix(header[i], "payload.") {
+			known[header[i]] = nil
+		}
+	}
+	check, _ := json.Marshal(known)
+	decoder := json.NewDecoder(bytes.NewReader(check))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&models.CreateQRRequest{}); err != nil {
+		return nil, fmt.Errorf("Invalid CSV header: %v", err)
+	}
+
+	var rows []bulkRow
+	for _, record := range records[1:] {
+		rows = append(rows, csvRow(header, record))
+	}
+	return rows, nil
+}
+
+// csvRow turns a CSV record into a JSON create request
+func csvRow(header, record []string) bulkRow {
+	fields := map[string]interface{}{}
+	payloadFields := map[string]interface{}{}
+	for i, cell := range record {
+		name := header[i]
+		switch {
+		case cell == "":
+		case strings.HasPrefix(name, "payload."):
+			payloadFields[strings.TrimPrefix(name, "payload.")] = cell
+		case csvJSONColumns[name]:
+			if !json.Valid([]byte(cell)) {
+				return bulkRow{err: fmt.Errorf("%s: invalid JSON value %q", name, cell)}
+			}
+			fields[name] = json.RawMessage(cell)
+		default:
+			fields[name] = cell
+		}
+	}
+
+	// payload.<field> columns add to the fields of a payload column
+	if len(payloadFields) > 0 {
+		if raw, ok := fields["payload"].(json.RawMessage); ok {
+			if err := json.Unmarshal(raw, &payloadFields); err != nil {
+				return bulkRow{err: fmt.Errorf("payload: must be a JSON object")}
+			}
+			for i, cell := range record {
+				if name := header[i]; cell != "" && strings.HasPrefix(name, "payload.") {
+					payloadFields[strings.TrimPrefix(name, "payload.")] = cell
+				}
+			}
+		}
+		fields["payload"] = payloadFields
+	}
+
+	data, err := json.Marshal(fields)
+	return bulkRow{data: data, err: err}
+}
+
+// generateJobID returns a random ID for a bulk job
+func generateJobID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/safety"
+	"github.com/gin-gonic/gin"
+)
+
+func bulkRequest(t *testing.T, h *Handler, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/qr/bulk", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	h.CreateQRBulk(c)
+	return w
+}
+
+func jobRequest(h *Handler, handler func(*Handler, *gin.Context), jobID string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "job", Value: jobID}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	handler(h, c)
+	return w
+}
+
+// waitForJob polls a bulk job until it is no longer running
+func waitForJob(t *testing.T, h *Handler, jobID string) models.BulkJob {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, err := h.loadBulkJob(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != bulkRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bulk job still running after %d of %d codes", job.Completed, job.Total)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCreateQRBulkRejectsRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("BULK_MAX_ROWS", "3")
+	db := openTestDB(t)
+	h := &Handler{db: db, safety: &safety.Policy{Schemes: []string{"https"}}}
+
+	for _, tc := range []struct {
+		name, contentType, body string
+		wantRows                []int
+	}{
+		{"invalid rows", "application/json",
+			`[{"title": "A", "target_url": "https://example.com/a"}, {"target_url": "https://example.com/b"},
+			  {"title": "C", "target_url": "ftp://example.com/c"}]`, []int{2, 3}},
+		{"invalid CSV cell", "text/csv",
+			"title,target_url,max_scans\nA,https://example.com/a,\nB,https://example.com/b,{oops\n", []int{2}},
+		{"too many rows", "application/json",
+			`[{"title": "A", "target_url": "https://example.com/a"}, {"title": "B", "target_url": "https://example.com/b"},
+			  {"title": "C", "target_url": "https://example.com/c"}, {"title": "D", "target_url": "https://example.com/d"}]`, nil},
+		{"unknown CSV column", "text/csv", "title,colour\nA,red\n", nil},
+		{"no rows", "application/json", `[]`, nil},
+		{"not an array", "application/json", `{"title": "A"}`, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := bulkRequest(t, h, tc.contentType, tc.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var response struct {
+				Errors []models.BulkRowError `json:"errors"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			var rows []int
+			for _, rowError := range response.Errors {
+				rows = append(rows, rowError.Row)
+			}
+			if fmt.Sprint(rows) != fmt.Sprint(tc.wantRows) {
+				t.Errorf("row errors %v, want rows %v", response.Errors, tc.wantRows)
+			}
+
+			// Nothing is created when any row is rejected
+			var codes, jobs int
+			db.QueryRow("SELECT COUNT(*) FROM qr_codes").Scan(&codes)
+			db.QueryRow("SELECT COUNT(*) FROM bulk_jobs").Scan(&jobs)
+			if codes != 0 || jobs != 0 {
+				t.Errorf("%d QR codes and %d jobs created", codes, jobs)
+			}
+		})
+	}
+}
+
+func TestBulkJobLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	db := openTestDB(t)
+	h := &Handler{db: db, safety: &safety.Policy{Schemes: []string{"https"}}}
+
+	w := bulkRequest(t, h, "text/csv", "\xef\xbb\xbftitle,target_url,tags\nTable 1,https://example.com/1,\"[\"\"tables\"\"]\"\nTable 2,https://example.com/2,\n")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var created models.BulkJob
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Status != bulkRunning || created.Total != 2 || len(created.QRCodes) != 2 || created.QRCodes[0].Tags[0] != "tables" {
+		t.Fatalf("created job %+v", created)
+	}
+
+	job := waitForJob(t, h, created.ID)
+	if job.Status != bulkDone || job.Completed != 2 || job.FinishedAt == nil || job.Error != "" {
+		t.Errorf("finished job %+v", job)
+	}
+	if w := jobRequest(h, (*Handler).GetBulkJob, created.ID); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"done"`) {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+
+	w = jobRequest(h, (*Handler).DownloadBulkJob, created.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("download: status %d: %s", w.Code, w.Body)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range archive.File {
+		names = append(names, entry.Name)
+	}
+	want := "codes.csv," + created.QRCodes[0].Code + ".png," + created.QRCodes[1].Code + ".png"
+	if strings.Join(names, ",") != want {
+		t.Errorf("entries %v, want %s", names, want)
+	}
+
+	if w := jobRequest(h, (*Handler).GetBulkJob, "missing"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d", w.Code)
+	}
+}
+
+func TestBulkJobStatuses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	db := openTestDB(t)
+	h := &Handler{db: db}
+
+	// A running job can't be downloaded yet
+	db.Exec("INSERT INTO bulk_jobs (id, status, total) VALUES ('running', ?, 2)", bulkRunning)
+	if w := jobRequest(h, (*Handler).DownloadBulkJob, "running"); w.Code != http.StatusConflict {
+		t.Errorf("running job download: status %d", w.Code)
+	}
+
+	// Codes whose image can't be generated fail the job
+	db.Exec("INSERT INTO bulk_jobs (id, status, total) VALUES ('failing', ?, 2)", bulkRunning)
+	h.runBulkJob("failing", []models.QRCode{
+		{Code: "fits", Content: "https://example.com", Size: 256},
+		{Code: "too-long", Content: strings.Repeat("x", 4000), Size: 256},
+	})
+	job, err := h.loadBulkJob("failing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != bulkFailed || job.Completed != 2 || !strings.Contains(job.Error, "too-long") || job.FinishedAt == nil {
+		t.Errorf("failed job %+v", job)
+	}
+
+	// Jobs interrupted by a restart are resumed
+	qr := insertTestQR(t, db, "resumed", accessOpen, nil)
+	db.Exec("UPDATE qr_codes SET bulk_job_id = 'running' WHERE id = ?", qr.ID)
+	db.Exec("UPDATE bulk_jobs SET total = 1 WHERE id = 'running'")
+	h.ResumeBulkJobs()
+	if job := waitForJob(t, h, "running"); job.Status != bulkDone || job.Completed != 1 {
+		t.Errorf("resumed job %+v", job)
+	}
+}
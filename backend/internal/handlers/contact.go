@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/payload"
+	"github.com/gin-gonic/gin"
+)
+
+// contactPage is the landing page of a dynamic vCard code. Its download
+// link asks the redirect URL it was served from for the .vcf, with a token
+// issued for this page view. The token stands in for the password of
+// protected codes, so the page never holds it.
+const contactPage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>{{.Card.FullName}}</title>
+    <style>
+        body { font-family: sans-serif; max-width: 30rem; margin: 0 auto; padding: 2rem 1rem; color: #222; }
+        h1 { margin-bottom: 0.25rem; }
+        .role { color: #666; margin-top: 0; }
+        dl { margin: 1.5rem 0; }
+        dt { font-size: 0.8rem; color: #666; text-transform: uppercase; margin-top: 1rem; }
+        dd { margin: 0.25rem 0 0; word-break: break-word; white-space: pre-line; }
+        a { color: #0b57d0; }
+        .add { display: block; width: 100%; padding: 0.9rem; border: 0; border-radius: 0.5rem; background: #0b57d0;
+               color: #fff; font-size: 1rem; text-align: center; text-decoration: none; box-sizing: border-box; }
+    </style>
+</head>
+<body>
+    <h1>{{.Card.FullName}}</h1>
+    {{if or .Card.JobTitle .Card.Organization}}<p class="role">{{.Card.JobTitle}}{{if and .Card.JobTitle .Card.Organization}}, {{end}}{{.Card.Organization}}</p>{{end}}
+    <a class="add" href="?format=vcf&token={{.Token}}">Add to contacts</a>
+    <dl>
+        {{with .Card.Mobile}}<dt>Mobile</dt><dd><a href="tel:{{.}}">{{.}}</a></dd>{{end}}
+        {{with .Card.Phone}}<dt>Phone</dt><dd><a href="tel:{{.}}">{{.}}</a></dd>{{end}}
+        {{with .Card.Email}}<dt>Email</dt><dd><a href="mailto:{{.}}">{{.}}</a></dd>{{end}}
+        {{with .Card.Website}}<dt>Website</dt><dd><a href="{{.}}" rel="noopener noreferrer">{{.}}</a></dd>{{end}}
+        {{with .Address}}<dt>Address</dt><dd>{{.}}</dd>{{end}}
+        {{with .Card.Note}}<dt>Note</dt><dd>{{.}}</dd>{{end}}
+    </dl>
+</body>
+</html>`
+
+var contactTemplate = template.Must(template.New("contact").Parse(contactPage))
+
+// contactPageData is passed to the contact page template
+type contactPageData struct {
+	Card    payload.VCardPayload
+	Address string
+	Token   string
+}
+
+// vcfLinkTTL is how long the download link of a contact page stays valid
+const vcfLinkTTL = 10 * time.Minute
+
+var (
+	vcfKeyOnce sync.Once
+	vcfKey     []byte
+)
+
+// vcfLinkKey signs the download links of contact pages: JWT_SECRET, or a
+// random key when it isn't set, in which case links don't survive a restart
+func vcfLinkKey() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	vcfKeyOnce.Do(func() {
+		vcfKey = make([]byte, 32)
+		rand.Read(vcfKey)
+	})
+	return vcfKey
+}
+
+// signVCFLink returns the token of a download link, issued with a counted
+// page view
+func signVCFLink(qrID int, now time.Time) string {
+	expires := strconv.FormatInt(now.Add(vcfLinkTTL).Unix(), 36)
+	return expires + "." + vcfLinkSignature(qrID, expires)
+}
+
+// validVCFLink reports whether a download link token was issued for the
+// QR code and hasn't expired
+func validVCFLink(qrID int, token string, now time.Time) bool {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(vcfLinkSignature(qrID, expires))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 36, 64)
+	return err == nil && now.Unix() < unix
+}
+
+func vcfLinkSignature(qrID int, expires string) string {
+	mac := hmac.New(sha256.New, vcfLinkKey())
+	fmt.Fprintf(mac, "vcf:%d:%s", qrID, expires)
+	return hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// vcfDownload reports whether a request follows the download link of a
+// contact page
+func vcfDownload(c *gin.Context, qr models.QRCode, now time.Time) bool {
+	return qr.PayloadType == payload.VCard && c.Query("format") == "vcf" && validVCFLink(qr.ID, c.Query("token"), now)
+}
+
+// serveContact answers scans of a dynamic vCard code with its contact page,
+// or with the vCard itself when the page's download link is followed. Page
+// views count towards a scan limit; downloads don't, so they need a token
+// from a page view. Download requests without one get the page instead.
+func (h *Handler) serveContact(c *gin.Context, qr models.QRCode, scan scanInfo) {
+	var card payload.VCardPayload
+	if err := json.Unmarshal(qr.Payload, &card); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read contact"})
+		return
+	}
+
+	now := time.Now()
+	if vcfDownload(c, qr, now) {
+		vcf, err := card.Encode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not encode contact"})
+			return
+		}
+		scan.EventType = eventVCardDownload
+		h.recordScan(qr.ID, scan)
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.vcf"`, safeFilename(card.FullName(), "contact")))
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "text/vcard; charset=utf-8", []byte(vcf))
+		return
+	}
+
+	if allowed, err := h.consumeRedirect(qr); err != nil {
+		log.Printf("Error counting page view: %v", err)
+		if scanLimit(qr) > 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	} else if !allowed {
+		scan.EventType = eventLimitReached
+		h.recordScan(qr.ID, scan)
+		serveGone(c, qr, "QR code has reached its scan limit")
+		return
+	}
+	scan.EventType = eventPageView
+	h.recordScan(qr.ID, scan)
+
+	data := contactPageData{
+		Card:    card,
+		Address: strings.Join(card.AddressLines(), "\n"),
+		Token:   signVCFLink(qr.ID, now),
+	}
+
+	var page bytes.Buffer
+	if err := contactTemplate.Execute(&page, data); err != nil {
+		log.Printf("Error rendering contact page: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render contact page"})
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVCFLinkToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	now := time.Now()
+	token := signVCFLink(7, now)
+
+	for _, tc := range []struct {
+		name  string
+		qrID  int
+		token string
+		at    time.Time
+		want  bool
+	}{
+		{"issued link", 7, token, now, true},
+		{"other code", 8, token, now, false},
+		{"expired link", 7, token, now.Add(vcfLinkTTL), false},
+		{"tampered expiry", 7, "zzzzzz" + token[strings.Index(token, "."):], now, false},
+		{"missing token", 7, "", now, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validVCFLink(tc.qrID, tc.token, tc.at); got != tc.want {
+				t.Errorf("validVCFLink = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProtectedContactDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "secret")
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	result, err := db.Exec(`INSERT INTO qr_codes (code, title, target_url, payload_type, payload, dynamic, access_mode, password_hash)
+		VALUES ('card', 'Card', '', 'vcard', '{"first_name": "Jean", "last_name": "Dupont"}', 1, ?, ?)`, accessPassword, string(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+
+	redirect := func(method, query string, form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "code", Value: "card"}}
+		c.Request = httptest.NewRequest(method, "/r/card?"+query, strings.NewReader(form.Encode()))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.RedirectQR(c)
+		return w
+	}
+
+	// The contact page is behind the password and doesn't hold it
+	if w := redirect(http.MethodGet, "", nil); !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Fatalf("no password form: %s", w.Body)
+	}
+	w := redirect(http.MethodPost, "", url.Values{"password": {"hunter2"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Jean Dupont") {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "hunter2") {
+		t.Error("contact page contains the password")
+	}
+
+	// Its download link works on its own, a made-up one doesn't
+	token := signVCFLink(int(id), time.Now())
+	if !strings.Contains(w.Body.String(), "token="+token) {
+		t.Fatalf("no download link in %s", w.Body)
+	}
+	w = redirect(http.MethodGet, "format=vcf&token="+token, nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "BEGIN:VCARD") {
+		t.Errorf("download: status %d: %s", w.Code, w.Body)
+	}
+	w = redirect(http.MethodGet, "format=vcf&token=0."+strings.Repeat("0", 24), nil)
+	if strings.HasPrefix(w.Body.String(), "BEGIN:VCARD") || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Errorf("forged token: status %d: %s", w.Code, w.Body)
+	}
+}
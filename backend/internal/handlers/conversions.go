@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// clickIDParam is the query parameter carrying the click ID to the target
+const clickIDParam = "qr_click_id"
+
+// transparentGIF is a 1x1 transparent GIF returned by the conversion pixel
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+var (
+	errInvalidClickID      = errors.New("invalid click ID")
+	errNoClickIDSecret     = errors.New("conversion tracking requires CLICK_ID_SECRET or JWT_SECRET")
+	errDuplicateConversion = errors.New("conversion already recorded")
+	errInvalidValue        = errors.New("value must be a finite number")
+)
+
+// clickIDSecret returns the key click IDs are signed with. Without one,
+// click IDs could be forged, so conversions aren't tracked at all.
+func clickIDSecret() string {
+	if secret := os.Getenv("CLICK_ID_SECRET"); secret != "" {
+		return secret
+	}
+	return os.Getenv("JWT_SECRET")
+}
+
+// signClickID returns a click ID for a scan: the scan ID followed by a
+// signature, so conversions can't be attributed to made-up scans
+func signClickID(scanID int64) string {
+	id := strconv.FormatInt(scanID, 36)
+	return id + "." + clickIDSignature(id)
+}
+
+// parseClickID verifies a click ID and returns its scan ID
+func parseClickID(clickID string) (int64, error) {
+	if clickIDSecret() == "" {
+		return 0, errNoClickIDSecret
+	}
+	id, signature, ok := strings.Cut(clickID, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(clickIDSignature(id))) {
+		return 0, errInvalidClickID
+	}
+	scanID, err := strconv.ParseInt(id, 36, 64)
+	if err != nil {
+		return 0, errInvalidClickID
+	}
+	return scanID, nil
+}
+
+func clickIDSignature(id string) string {
+	mac := hmac.New(sha256.New, []byte(clickIDSecret()))
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// RecordConversion attributes a conversion posted by the target site to
+// the scan and QR code its click ID came from
+func (h *Handler) RecordConversion(c *gin.Context) {
+	var req models.ConversionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.saveConversion(req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Conversion recorded successfully"})
+}
+
+// ConversionPixel records a conversion from a 1x1 image request, for
+// pages that can't make a server-side postback
+func (h *Handler) ConversionPixel(c *gin.Context) {
+	req := models.ConversionRequest{
+		ClickID: c.Query("click_id"),
+		Event:   c.DefaultQuery("event", "conversion"),
+	}
+	status := http.StatusOK
+	if value := c.Query("value"); value != "" {
+		var err error
+		if req.Value, err = strconv.ParseFloat(value, 64); err != nil {
+			status = http.StatusBadRequest
+		}
+	}
+
+	if req.ClickID == "" {
+		status = http.StatusBadRequest
+	}
+	if status == http.StatusOK {
+		if code, err := h.saveConversion(req); err != nil {
+			status = code
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(status, "image/gif", transparentGIF)
+}
+
+// saveConversion stores a conversion and returns the HTTP status to
+// report if it fails. Each event is recorded once per click ID, so replays
+// don't inflate counts.
+func (h *Handler) saveConversion(req models.ConversionRequest) (int, error) {
+	scanID, err := parseClickID(req.ClickID)
+	if err == errNoClickIDSecret {
+		return http.StatusServiceUnavailable, err
+	}
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if math.IsInf(req.Value, 0) || math.IsNaN(req.Value) {
+		return http.StatusBadRequest, errInvalidValue
+	}
+	if req.Event == "" {
+		req.Event = "conversion"
+	}
+
+	var qrID int
+	var variantID sql.NullInt64
+	err = h.db.QueryRow("SELECT qr_code_id, variant_id FROM qr_scans WHERE id = ?", scanID).Scan(&qrID, &variantID)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, errors.New("scan not found")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("could not fetch scan")
+	}
+
+	result, err := h.db.Exec(`INSERT INTO qr_conversions (scan_id, qr_code_id, variant_id, event, value) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (scan_id, event) DO NOTHING`,
+		scanID, qrID, variantID, req.Event, req.Value)
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("could not record conversion")
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return http.StatusConflict, errDuplicateConversion
+	}
+	return http.StatusOK, nil
+}
+
+// conversionRate is the share of scans that led to at least one conversion
+func conversionRate(convertedScans, scans int) float64 {
+	if scans == 0 {
+		return 0
+	}
+	return float64(convertedScans) / float64(scans)
+}
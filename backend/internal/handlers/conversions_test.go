@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversionPixelValue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CLICK_ID_SECRET", "secret")
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	qr := insertTestQR(t, db, "pixel", accessOpen, nil)
+
+	for _, tc := range []struct {
+		value string
+		want  int
+	}{
+		{"", http.StatusOK},
+		{"19.90", http.StatusOK},
+		{"abc", http.StatusBadRequest},
+		{"1e400", http.StatusBadRequest},
+		{"Inf", http.StatusBadRequest},
+		{"-Inf", http.StatusBadRequest},
+		{"NaN", http.StatusBadRequest},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			result, err := db.Exec("INSERT INTO qr_scans (qr_code_id) VALUES (?)", qr.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scanID, _ := result.LastInsertId()
+
+			query := url.Values{"click_id": {signClickID(scanID)}, "value": {tc.value}}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/c.gif?"+query.Encode(), nil)
+			h.ConversionPixel(c)
+			if w.Code != tc.want {
+				t.Errorf("status %d, want %d", w.Code, tc.want)
+			}
+
+			var stored int
+			db.QueryRow("SELECT COUNT(*) FROM qr_conversions WHERE scan_id = ?", scanID).Scan(&stored)
+			if stored > 0 != (tc.want == http.StatusOK) {
+				t.Errorf("%d conversions stored", stored)
+			}
+		})
+	}
+
+	// The stored values still add up to a number
+	var total float64
+	if err := db.QueryRow("SELECT COALESCE(SUM(value), 0) FROM qr_conversions").Scan(&total); err != nil || total != 19.9 {
+		t.Errorf("total value %v, %v", total, err)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// domainContextKey holds the ID of the custom domain a redirect came in on
+const domainContextKey = "custom_domain_id"
+
+var errUnknownDomain = errors.New("domain_id does not match a registered domain")
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// normalizeHostname lowercases a hostname and checks it is a plain domain
+// name, without scheme, port or path
+func normalizeHostname(hostname string) (string, error) {
+	hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+	if len(hostname) > 253 || !hostnamePattern.MatchString(hostname) {
+		return "", fmt.Errorf("hostname must be a domain name such as go.example.com")
+	}
+	return hostname, nil
+}
+
+// shortURL returns the URL encoded in a QR code: hostname/code on its custom
+// domain, or BASE_URL/r/code. CUSTOM_DOMAIN_SCHEME sets the scheme of custom
+// domains, https by default.
+func shortURL(code, hostname string) string {
+	if hostname == "" {
+		return fmt.Sprintf("%s/r/%s", os.Getenv("BASE_URL"), code)
+	}
+	scheme := os.Getenv("CUSTOM_DOMAIN_SCHEME")
+	if scheme == "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, hostname, code)
+}
+
+// resolveDomain returns the ID and hostname of the custom domain a new QR
+// code uses: the requested one, which must exist, none for 0, or else the
+// default domain if there is one
+func (h *Handler) resolveDomain(domainID *int) (sql.NullInt64, string, error) {
+	var id sql.NullInt64
+	var hostname string
+	var err error
+	if domainID != nil && *domainID == 0 {
+		return id, "", nil
+	}
+	if domainID != nil {
+		err = h.db.QueryRow("SELECT id, hostname FROM custom_domains WHERE id = ?", *domainID).Scan(&id, &hostname)
+		if err == sql.ErrNoRows {
+			return id, "", errUnknownDomain
+		}
+	} else {
+		err = h.db.QueryRow("SELECT id, hostname FROM custom_domains WHERE is_default = 1").Scan(&id, &hostname)
+		if err == sql.ErrNoRows {
+			return id, "", nil
+		}
+	}
+	return id, hostname, err
+}
+
+// ServeCustomDomain redirects /<code> on a registered custom domain, for
+// the codes on it and those moved off it since they were printed. It
+// handles requests no other route matched, so /r/<code> keeps working on
+// every host.
+func (h *Handler) ServeCustomDomain(c *gin.Context) {
+	code := strings.TrimPrefix(c.Request.URL.Path, "/")
+	if code == "" || strings.Contains(code, "/") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	hostname := c.Request.Host
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+
+	var domainID int
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	err := h.db.QueryRow("SELECT id FROM custom_domains WHERE hostname = ?", hostname).Scan(&domainID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.Params = append(c.Params, gin.Param{Key: "code", Value: code})
+	c.Set(domainContextKey, domainID)
+	h.RedirectQR(c)
+}
+
+// ListDomains lists the registered custom domains
+func (h *Handler) ListDomains(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT d.id, d.hostname, d.is_default, d.created_at,
+							 (SELECT COUNT(*) FROM qr_codes q WHERE q.domain_id = d.id) as qr_codes
+							 FROM custom_domains d ORDER BY d.hostname`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch domains"})
+		return
+	}
+	defer rows.Close()
+
+	domains := []models.Domain{}
+	for rows.Next() {
+		var domain models.Domain
+		if err := rows.Scan(&domain.ID, &domain.Hostname, &domain.IsDefault, &domain.CreatedAt, &domain.QRCodes); err != nil {
+			continue
+		}
+		domains = append(domains, domain)
+	}
+
+	c.JSON(http.StatusOK, domains)
+}
+
+// CreateDomain registers a custom domain. Its DNS has to point at this
+// server for redirects to reach it.
+func (h *Handler) CreateDomain(c *gin.Context) {
+	var req models.DomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hostname, err := normalizeHostname(req.Hostname)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create domain"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if tx.QueryRow("SELECT 1 FROM custom_domains WHERE hostname = ?", hostname).Scan(&exists) == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Domain is already registered"})
+		return
+	}
+	if req.IsDefault {
+		if _, err := tx.Exec("UPDATE custom_domains SET is_default = 0"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create domain"})
+			return
+		}
+	}
+	result, err := tx.Exec("INSERT INTO custom_domains (hostname, is_default) VALUES (?, ?)", hostname, req.IsDefault)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create domain"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create domain"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	c.JSON(http.StatusOK, models.Domain{ID: int(id), Hostname: hostname, IsDefault: req.IsDefault, CreatedAt: time.Now()})
+}
+
+// SetDefaultDomain makes a custom domain the default for new QR codes, or
+// clears the default if is_default is false
+func (h *Handler) SetDefaultDomain(c *gin.Context) {
+	id := c.Param("id")
+	var req models.DefaultDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update domain"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow("SELECT 1 FROM custom_domains WHERE id = ?", id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update domain"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE custom_domains SET is_default = (id = ? AND ?)", id, req.IsDefault); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update domain"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update domain"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain updated successfully"})
+}
+
+// DeleteDomain unregisters a custom domain that no QR code uses anymore,
+// nor was printed with before moving to another domain
+func (h *Handler) DeleteDomain(c *gin.Context) {
+	id := c.Param("id")
+
+	var inUse int
+	err := h.db.QueryRow(`SELECT COUNT(*) FROM qr_codes WHERE domain_id = ?
+		OR id IN (SELECT qr_code_id FROM qr_code_domains WHERE domain_id = ?)`, id, id).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check domain usage"})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Domain is used by %d QR codes", inUse)})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM custom_domains WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete domain"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain deleted successfully"})
+}
+
+// keepPreviousDomain records the custom domain of a QR code before it
+// moves to another one, so the copies printed with it keep resolving
+func (h *Handler) keepPreviousDomain(qrID string, domainID int) error {
+	_, err := h.db.Exec(`INSERT OR IGNORE INTO qr_code_domains (qr_code_id, domain_id)
+		SELECT id, domain_id FROM qr_codes
+		WHERE id = ? AND deleted_at IS NULL AND domain_id IS NOT NULL AND domain_id != ?`, qrID, domainID)
+	return err
+}
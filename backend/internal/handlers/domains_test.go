@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GridexX/qr-tracker/internal/safety"
+	"github.com/GridexX/qr-tracker/internal/sinks"
+	"github.com/gin-gonic/gin"
+)
+
+// newDomainTestHandler returns a handler able to redirect, with the custom
+// domains go.example.com (1) and qr.example.org (2)
+func newDomainTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	db := openTestDB(t)
+	if _, err := db.Exec("INSERT INTO custom_domains (hostname) VALUES ('go.example.com'), ('qr.example.org')"); err != nil {
+		t.Fatal(err)
+	}
+	return &Handler{db: db, safety: &safety.Policy{Schemes: []string{"https"}}, sinks: sinks.NewDispatcher()}
+}
+
+func serveHost(h *Handler, host, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+	c.Request.Host = host
+	h.ServeCustomDomain(c)
+	return w
+}
+
+func TestServeCustomDomainHost(t *testing.T) {
+	h := newDomainTestHandler(t)
+	qr := insertTestQR(t, h.db, "abc", accessOpen, nil)
+	h.db.Exec("UPDATE qr_codes SET domain_id = 1 WHERE id = ?", qr.ID)
+	insertTestQR(t, h.db, "elsewhere", accessOpen, nil)
+
+	for _, tc := range []struct {
+		host, path string
+		want       int
+	}{
+		{"go.example.com", "/abc", http.StatusFound},
+		{"GO.Example.COM", "/abc", http.StatusFound},
+		{"go.example.com:8080", "/abc", http.StatusFound},
+		{"go.example.com.", "/abc", http.StatusFound},
+		{"Go.Example.com.:443", "/abc", http.StatusFound},
+		{"go.example.com", "/elsewhere", http.StatusNotFound},
+		{"qr.example.org", "/abc", http.StatusNotFound},
+		{"unknown.example.com", "/abc", http.StatusNotFound},
+		{"go.example.com", "/abc/extra", http.StatusNotFound},
+		{"go.example.com", "/", http.StatusNotFound},
+	} {
+		t.Run(tc.host+tc.path, func(t *testing.T) {
+			w := serveHost(h, tc.host, tc.path)
+			if w.Code != tc.want {
+				t.Errorf("status %d, want %d", w.Code, tc.want)
+			}
+			if tc.want == http.StatusFound && w.Header().Get("Location") != "https://example.com" {
+				t.Errorf("redirected to %q", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestPrintedCodesKeepPreviousDomain(t *testing.T) {
+	h := newDomainTestHandler(t)
+	qr := insertTestQR(t, h.db, "moved", accessOpen, nil)
+	h.db.Exec("UPDATE qr_codes SET domain_id = 1 WHERE id = ?", qr.ID)
+
+	update := func(body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(qr.ID)}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.UpdateQR(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("update: status %d: %s", w.Code, w.Body)
+		}
+	}
+	deleteDomain := func(id string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Request = httptest.NewRequest(http.MethodDelete, "/", nil)
+		h.DeleteDomain(c)
+		return w.Code
+	}
+
+	// Move the code to the other domain, then off custom domains
+	update(`{"domain_id": 2}`)
+	for _, host := range []string{"go.example.com", "qr.example.org"} {
+		if w := serveHost(h, host, "/moved"); w.Code != http.StatusFound {
+			t.Errorf("after the move, %s: status %d", host, w.Code)
+		}
+	}
+	update(`{"domain_id": 0}`)
+	for _, host := range []string{"go.example.com", "qr.example.org"} {
+		if w := serveHost(h, host, "/moved"); w.Code != http.StatusFound {
+			t.Errorf("after leaving custom domains, %s: status %d", host, w.Code)
+		}
+	}
+
+	// Domains printed on copies can't be deleted
+	for _, id := range []string{"1", "2"} {
+		if status := deleteDomain(id); status != http.StatusConflict {
+			t.Errorf("delete domain %s: status %d", id, status)
+		}
+	}
+	h.db.Exec("INSERT INTO custom_domains (hostname) VALUES ('unused.example.net')")
+	if status := deleteDomain("3"); status != http.StatusOK {
+		t.Errorf("delete unused domain: status %d", status)
+	}
+	if status := deleteDomain("3"); status != http.StatusNotFound {
+		t.Errorf("delete missing domain: status %d", status)
+	}
+
+	// A failed usage check doesn't delete the domain
+	h.db.Exec("DROP TABLE qr_code_domains")
+	if status := deleteDomain("1"); status != http.StatusInternalServerError {
+		t.Errorf("delete with a failed usage check: status %d", status)
+	}
+	var domains int
+	h.db.QueryRow("SELECT COUNT(*) FROM custom_domains").Scan(&domains)
+	if domains != 2 {
+		t.Errorf("%d domains left, want 2", domains)
+	}
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/sheet"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// maxExportCodes is the most QR codes one export may print
+const maxExportCodes = 5000
+
+// ExportQR streams the selected QR codes for printing, as a ZIP of PNG or
+// SVG images or as a PDF label sheet. Codes are rendered one at a time, so
+// large batches aren't held in memory.
+func (h *Handler) ExportQR(c *gin.Context) {
+	var req models.ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 && len(req.Tags) == 0 && req.FolderID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids, tags or folder_id is required"})
+		return
+	}
+	if len(req.IDs) > maxExportCodes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d QR codes can be exported at once", maxExportCodes)})
+		return
+	}
+
+	var qrCodes []models.QRCode
+	if len(req.IDs) > 0 {
+		var missing []int
+		var err error
+		qrCodes, missing, err = h.loadQRCodes(req.IDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR codes"})
+			return
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "QR codes not found", "ids": missing})
+			return
+		}
+	} else {
+		folder := ""
+		if req.FolderID != nil {
+			folder = strconv.Itoa(*req.FolderID)
+		}
+		scope, args, _ := codeScope(req.Tags, folder, "")
+		var err error
+		qrCodes, err = h.loadScopedCodes(scope, args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR codes"})
+			return
+		}
+		if len(qrCodes) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No QR codes match"})
+			return
+		}
+		if len(qrCodes) > maxExportCodes {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d QR codes can be exported at once", maxExportCodes)})
+			return
+		}
+	}
+
+	if req.Format == "pdf" {
+		h.exportSheet(c, req.Sheet, qrCodes)
+		return
+	}
+	exportImages(c, req, qrCodes)
+}
+
+// loadQRCodes reads QR codes by ID in the order given, repeating any ID
+// given more than once. IDs of unknown or deleted codes are returned as
+// missing.
+func (h *Handler) loadQRCodes(ids []int) ([]models.QRCode, []int, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := h.db.Query(`SELECT `+qrCodeColumns+` FROM qr_codes q
+							 WHERE q.id IN (`+placeholders+`) AND q.deleted_at IS NULL`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]models.QRCode{}
+	for rows.Next() {
+		var qr models.QRCode
+		if err := scanQRCode(rows, &qr); err != nil {
+			return nil, nil, err
+		}
+		byID[qr.ID] = qr
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var qrCodes []models.QRCode
+	var missing []int
+	for _, id := range ids {
+		if qr, ok := byID[id]; ok {
+			qrCodes = append(qrCodes, qr)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return qrCodes, missing, nil
+}
+
+// loadScopedCodes reads the live QR codes within a code scope, oldest
+// first
+func (h *Handler) loadScopedCodes(scope string, args []interface{}) ([]models.QRCode, error) {
+	rows, err := h.db.Query(`SELECT `+qrCodeColumns+` FROM qr_codes q
+							 WHERE q.deleted_at IS NULL AND `+scope+` ORDER BY q.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var qrCodes []models.QRCode
+	for rows.Next() {
+		var qr models.QRCode
+		if err := scanQRCode(rows, &qr); err != nil {
+			return nil, err
+		}
+		qrCodes = append(qrCodes, qr)
+	}
+	return qrCodes, rows.Err()
+}
+
+// exportImages streams a ZIP with an image of each QR code, named after
+// its code or title
+func exportImages(c *gin.Context, req models.ExportRequest, qrCodes []models.QRCode) {
+	extension := ".png"
+	if req.ImageFormat == "svg" {
+		extension = ".svg"
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="qr-codes.zip"`)
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	used := map[string]bool{}
+	for _, qr := range qrCodes {
+		name := qr.Code
+		if req.NameBy == "title" {
+			name = safeFilename(qr.Title, qr.Code)
+			if used[name] {
+				name += "-" + qr.Code
+			}
+		}
+		// Codes listed twice get a numbered copy
+		for base, n := name, 2; used[name]; n++ {
+			name = base + "-" + strconv.Itoa(n)
+		}
+		used[name] = true
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: name + extension, Method: zip.Deflate, Modified: time.Now()})
+		if err == nil {
+			err = writeExportImage(entry, qr, req.ImageFormat)
+		}
+		if err != nil {
+			log.Printf("Error exporting QR code %s: %v", qr.Code, err)
+			break
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Error writing QR code export: %v", err)
+	}
+}
+
+// writeExportImage renders a QR code in its colors as PNG or SVG
+func writeExportImage(w io.Writer, qr models.QRCode, format string) error {
+	code, err := qrcode.New(qr.Content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	code.ForegroundColor = parseHexColor(qr.ForegroundColor, color.Black)
+	code.BackgroundColor = parseHexColor(qr.BackgroundColor, color.White)
+
+	if format == "svg" {
+		return writeSVG(w, code.Bitmap(), qr.ForegroundColor, qr.BackgroundColor, qr.Size)
+	}
+	return code.Write(qr.Size, w)
+}
+
+// writeSVG draws the modules of a QR code as a single SVG path
+func writeSVG(w io.Writer, bitmap [][]bool, foreground, background string, size int) error {
+	if parseHexColor(foreground, nil) == nil {
+		foreground = "#000000"
+	}
+	if parseHexColor(background, nil) == nil {
+		background = "#FFFFFF"
+	}
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	modules := len(bitmap)
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="%s"/><path fill="%s" d="%s"/></svg>`+"\n",
+		size, size, modules, modules, modules, modules, background, foreground, path.String())
+	return err
+}
+
+// exportSheet streams a PDF label sheet of the QR codes, a page at a time
+func (h *Handler) exportSheet(c *gin.Context, options models.SheetOptions, qrCodes []models.QRCode) {
+	layout := sheet.Layout{
+		PageSize:  options.PageSize,
+		Columns:   options.Columns,
+		Rows:      options.Rows,
+		Margin:    10,
+		Gap:       5,
+		Captions:  options.Caption != "none",
+		CropMarks: options.CropMarks,
+	}
+	if layout.PageSize == "" {
+		layout.PageSize = "a4"
+	}
+	if layout.Columns == 0 {
+		layout.Columns = 3
+	}
+	if layout.Rows == 0 {
+		layout.Rows = 4
+	}
+	if options.Margin != nil {
+		layout.Margin = *options.Margin
+	}
+	if options.Gap != nil {
+		layout.Gap = *options.Gap
+	}
+
+	labels, err := sheet.NewWriter(c.Writer, layout)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="qr-codes.pdf"`)
+	c.Header("Content-Type", "application/pdf")
+	c.Status(http.StatusOK)
+
+	for _, qr := range qrCodes {
+		code, err := qrcode.New(qr.Content, qrcode.Medium)
+		if err != nil {
+			log.Printf("Error encoding QR code %s: %v", qr.Code, err)
+			continue
+		}
+		caption := qr.Title
+		if options.Caption == "code" || caption == "" {
+			caption = qr.Code
+		}
+		err = labels.Add(sheet.Label{
+			Bitmap:     code.Bitmap(),
+			Foreground: parseHexColor(qr.ForegroundColor, color.Black),
+			Background: parseHexColor(qr.BackgroundColor, color.White),
+			Caption:    caption,
+		})
+		if err != nil {
+			log.Printf("Error writing label sheet: %v", err)
+			return
+		}
+	}
+	if err := labels.Close(); err != nil {
+		log.Printf("Error writing label sheet: %v", err)
+	}
+}
+
+// parseHexColor parses a #RRGGBB color, returning fallback if it isn't one
+func parseHexColor(value string, fallback color.Color) color.Color {
+	if len(value) != 7 || value[0] != '#' {
+		return fallback
+	}
+	rgb, err := strconv.ParseUint(value[1:], 16, 32)
+	if err != nil {
+		return fallback
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+}
+
+// safeFilename turns a name into a download filename of ASCII letters,
+// digits, dashes and underscores, or fallback if none are left
+func safeFilename(name, fallback string) string {
+	filename := strings.Map(func(r rune) rune {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '-', r == '_':
+			return r
+		case r == ' ', r == '.':
+			return '_'
+		}
+		return -1
+	}, name)
+	if filename == "" {
+		return fallback
+	}
+	return filename
+}
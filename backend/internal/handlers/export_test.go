@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func exportRequest(t *testing.T, h *Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/qr/export", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.ExportQR(c)
+	return w
+}
+
+func TestExportZIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	insertTestQR(t, db, "zip-a", accessOpen, nil)
+	insertTestQR(t, db, "zip-b", accessOpen, nil)
+	db.Exec("UPDATE qr_codes SET title = 'Table 1/2', foreground_color = '#112233' WHERE code = 'zip-a'")
+
+	for _, tc := range []struct {
+		name, body string
+		want       []string
+	}{
+		{"png by code", `{"ids": [1, 2]}`, []string{"zip-a.png", "zip-b.png"}},
+		{"svg by title", `{"ids": [1, 2, 1], "image_format": "svg", "name_by": "title"}`,
+			[]string{"Table_12.svg", "Table_12-zip-a.svg", "zip-b.svg"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := exportRequest(t, h, tc.body)
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, entry := range archive.File {
+				names = append(names, entry.Name)
+				file, err := entry.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(file)
+				file.Close()
+				if err != nil {
+					t.Fatalf("%s: %v", entry.Name, err)
+				}
+				if strings.HasSuffix(entry.Name, ".png") {
+					if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+						t.Errorf("%s: %v", entry.Name, err)
+					}
+				} else {
+					checkSVG(t, entry.Name, data)
+				}
+			}
+			sort.Strings(names)
+			sort.Strings(tc.want)
+			if strings.Join(names, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("entries %v, want %v", names, tc.want)
+			}
+		})
+	}
+}
+
+// checkSVG parses an exported SVG and checks its root and colors
+func checkSVG(t *testing.T, name string, data []byte) {
+	t.Helper()
+	var svg struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2000/svg svg"`
+		ViewBox string   `xml:"viewBox,attr"`
+		Rect    struct {
+			Fill string `xml:"fill,attr"`
+		} `xml:"rect"`
+		Path struct {
+			Fill string `xml:"fill,attr"`
+			D    string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	if err := xml.Unmarshal(data, &svg); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if !regexp.MustCompile(`^0 0 (\d+) (\d+)$`).MatchString(svg.ViewBox) || svg.Rect.Fill != "#FFFFFF" {
+		t.Errorf("%s: viewBox %q, background %q", name, svg.ViewBox, svg.Rect.Fill)
+	}
+	if !regexp.MustCompile(`^(M\d+ \d+h\d+v1h-\d+z)+$`).MatchString(svg.Path.D) {
+		t.Errorf("%s: path %q", name, svg.Path.D)
+	}
+	if strings.HasPrefix(name, "Table") && svg.Path.Fill != "#112233" {
+		t.Errorf("%s: foreground %q", name, svg.Path.Fill)
+	}
+}
+
+func TestExportPDFPageCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	for _, code := range []string{"pdf-1", "pdf-2", "pdf-3", "pdf-4", "pdf-5"} {
+		insertTestQR(t, db, code, accessOpen, nil)
+	}
+
+	w := exportRequest(t, h, `{"ids": [1, 2, 3, 4, 5], "format": "pdf", "sheet": {"columns": 2, "rows": 1, "crop_marks": true}}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	file := w.Body.Bytes()
+	if count := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(file); count == nil || string(count[1]) != "3" {
+		t.Errorf("page count %q, want 3", count)
+	}
+	if pages := bytes.Count(file, []byte("/Type /Page ")); pages != 3 {
+		t.Errorf("%d page objects, want 3", pages)
+	}
+
+	if w := exportRequest(t, h, `{"ids": [1], "format": "pdf", "sheet": {"columns": 20, "rows": 30, "margin": 50}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("crowded grid: status %d", w.Code)
+	}
+}
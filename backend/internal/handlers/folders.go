@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+var errUnknownFolder = errors.New("folder not found")
+
+// folderTree selects a folder and every folder below it
+const folderTree = `WITH RECURSIVE tree(id) AS (
+	SELECT ? UNION SELECT f.id FROM folders f JOIN tree ON f.parent_id = tree.id
+) SELECT id FROM tree`
+
+// checkFolder returns errUnknownFolder if there is no folder with that ID
+func (h *Handler) checkFolder(id int) error {
+	var exists int
+	err := h.db.QueryRow("SELECT 1 FROM folders WHERE id = ?", id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return errUnknownFolder
+	}
+	return err
+}
+
+// ListFolders lists every folder with its path and how many QR codes it
+// holds directly
+func (h *Handler) ListFolders(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT f.id, f.name, f.parent_id, f.created_at,
+							 (SELECT COUNT(*) FROM qr_codes q WHERE q.folder_id = f.id AND q.deleted_at IS NULL)
+							 FROM folders f`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch folders"})
+		return
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	byID := map[int]*models.Folder{}
+	for rows.Next() {
+		var folder models.Folder
+		var parentID sql.NullInt64
+		if err := rows.Scan(&folder.ID, &folder.Name, &parentID, &folder.CreatedAt, &folder.QRCodes); err != nil {
+			continue
+		}
+		if parentID.Valid {
+			parent := int(parentID.Int64)
+			folder.ParentID = &parent
+		}
+		folders = append(folders, folder)
+	}
+	for i := range folders {
+		byID[folders[i].ID] = &folders[i]
+	}
+	for i := range folders {
+		folders[i].Path = folderPath(byID, &folders[i])
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Path < folders[j].Path })
+
+	c.JSON(http.StatusOK, folders)
+}
+
+// folderPath joins the names of a folder and its parents
+func folderPath(byID map[int]*models.Folder, folder *models.Folder) string {
+	names := []string{folder.Name}
+	for parent := folder.ParentID; parent != nil && len(names) <= len(byID); {
+		next, ok := byID[*parent]
+		if !ok {
+			break
+		}
+		names = append([]string{next.Name}, names...)
+		parent = next.ParentID
+	}
+	return strings.Join(names, "/")
+}
+
+// CreateFolder adds a folder, at the top level or under parent_id
+func (h *Handler) CreateFolder(c *gin.Context) {
+	var req models.FolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, status, err := h.checkFolderRequest(0, &req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.db.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, req.ParentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create folder"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	c.JSON(http.StatusOK, models.Folder{ID: int(id), Name: name, ParentID: req.ParentID, CreatedAt: time.Now()})
+}
+
+// UpdateFolder renames a folder or moves it under another parent. It
+// stays where it is when parent_id is left out.
+func (h *Handler) UpdateFolder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+	var req models.FolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var parentID sql.NullInt64
+	err = h.db.QueryRow("SELECT parent_id FROM folders WHERE id = ?", id).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch folder"})
+		return
+	}
+	if req.ParentID == nil && parentID.Valid {
+		parent := int(parentID.Int64)
+		req.ParentID = &parent
+	}
+	name, status, err := h.checkFolderRequest(id, &req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.db.Exec("UPDATE folders SET name = ?, parent_id = ? WHERE id = ?", name, req.ParentID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder updated successfully"})
+}
+
+// checkFolderRequest validates the name and parent of a new folder, or of
+// folder id when it is updated. Folders can't be moved into themselves or
+// their subfolders, and siblings need distinct names.
+func (h *Handler) checkFolderRequest(id int, req *models.FolderRequest) (string, int, error) {
+	if req.ParentID != nil && *req.ParentID == 0 {
+		req.ParentID = nil
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || strings.Contains(name, "/") {
+		return "", http.StatusBadRequest, fmt.Errorf("folder names must not be empty or contain /")
+	}
+
+	if req.ParentID != nil {
+		if err := h.checkFolder(*req.ParentID); err == errUnknownFolder {
+			return "", http.StatusBadRequest, fmt.Errorf("parent folder not found")
+		} else if err != nil {
+			return "", http.StatusInternalServerError, fmt.Errorf("Could not fetch folder")
+		}
+		if id != 0 {
+			var inside int
+			err := h.db.QueryRow("SELECT COUNT(*) FROM ("+folderTree+") WHERE id = ?", id, *req.ParentID).Scan(&inside)
+			if err != nil {
+				return "", http.StatusInternalServerError, fmt.Errorf("Could not fetch folder")
+			}
+			if inside > 0 {
+				return "", http.StatusBadRequest, fmt.Errorf("a folder can't be moved into itself or its subfolders")
+			}
+		}
+	}
+
+	var taken int
+	h.db.QueryRow("SELECT COUNT(*) FROM folders WHERE parent_id IS ? AND name = ? COLLATE NOCASE AND id != ?",
+		req.ParentID, name, id).Scan(&taken)
+	if taken > 0 {
+		return "", http.StatusConflict, fmt.Errorf("a folder named %q already exists there", name)
+	}
+	return name, http.StatusOK, nil
+}
+
+// DeleteFolder removes an empty folder. Folders holding QR codes, in the
+// trash included, or subfolders are kept.
+func (h *Handler) DeleteFolder(c *gin.Context) {
+	id := c.Param("id")
+
+	var codes, subfolders int
+	h.db.QueryRow("SELECT COUNT(*) FROM qr_codes WHERE folder_id = ?", id).Scan(&codes)
+	h.db.QueryRow("SELECT COUNT(*) FROM folders WHERE parent_id = ?", id).Scan(&subfolders)
+	if codes > 0 || subfolders > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Folder is not empty, move its QR codes and folders out first"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM folders WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete folder"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateFolderParent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	h := &Handler{db: db}
+
+	result, err := db.Exec("INSERT INTO folders (name) VALUES ('Events')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, _ := result.LastInsertId()
+	result, err = db.Exec("INSERT INTO folders (name, parent_id) VALUES ('Badges', ?)", parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, _ := result.LastInsertId()
+
+	for _, tc := range []struct {
+		name, body string
+		want       sql.NullInt64
+	}{
+		{"rename keeps the parent", `{"name": "Lanyards"}`, sql.NullInt64{Int64: parent, Valid: true}},
+		{"parent_id 0 moves to the top", `{"name": "Lanyards", "parent_id": 0}`, sql.NullInt64{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(child, 10)}}
+			c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(tc.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			h.UpdateFolder(c)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			var parentID sql.NullInt64
+			db.QueryRow("SELECT parent_id FROM folders WHERE id = ?", child).Scan(&parentID)
+			if parentID != tc.want {
+				t.Errorf("parent_id = %v, want %v", parentID, tc.want)
+			}
+		})
+	}
+}
@@ -4,12 +4,24 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html/template"
+	"log"
+	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/payload"
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/GridexX/qr-tracker/internal/safety"
+	"github.com/GridexX/qr-tracker/internal/sinks"
 	"github.com/GridexX/qr-tracker/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -17,11 +29,19 @@ import (
 )
 
 type Handler struct {
-	db *sql.DB
+	db           *sql.DB
+	interstitial *template.Template
+	pausedPage   *template.Template
+	sinks        *sinks.Dispatcher
+	safety       *safety.Policy
+
+	saltMu  sync.Mutex
+	saltDay string
+	salt    []byte
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *sql.DB, policy *safety.Policy) *Handler {
+	return &Handler{db: db, interstitial: loadInterstitial(), pausedPage: loadPausedPage(), sinks: sinks.FromEnv(), safety: policy}
 }
 
 func (h *Handler) Login(c *gin.Context) {
@@ -76,6 +96,44 @@ func (h *Handler) CreateQR(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	pending, status, err := h.prepareQRCode(&req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Insert into database
+	qrCode, err := insertQRCode(h.db, pending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create QR code"})
+		return
+	}
+
+	// Generate QR code image
+	if err := writeQRImage(qrCode.Code, qrCode.Content, qrCode.Size); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save QR image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, qrCode)
+}
+
+// pendingQR is a validated create request, ready to be inserted
+type pendingQR struct {
+	req          models.CreateQRRequest
+	passwordHash sql.NullString
+	domainID     sql.NullInt64
+	hostname     string
+	bulkJobID    sql.NullString
+	folderID     sql.NullInt64
+}
+
+// prepareQRCode validates a create request and fills in its defaults. On
+// error, it returns the HTTP status to answer with.
+func (h *Handler) prepareQRCode(req *models.CreateQRRequest) (*pendingQR, int, error) {
+	if err := h.validateQRRequest(req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
 	// Set defaults
 	if req.BackgroundColor == "" {
@@ -88,57 +146,139 @@ func (h *Handler) CreateQR(c *gin.Context) {
 		req.Size = 256
 	}
 
-	// Generate unique code
-	code, err := generateUniqueCode()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR code"})
-		return
+	pending := &pendingQR{req: *req}
+
+	// Hash the password of protected codes
+	if req.AccessMode == accessPassword {
+		if req.Password == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("password is required with the password access mode")
+		}
+		hash, err := hashAccessPassword(req.Password)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("Could not hash password")
+		}
+		pending.passwordHash = hash
 	}
 
-	// Insert into database
-	query := `INSERT INTO qr_codes (code, title, target_url, background_color, foreground_color, size) 
-			  VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := h.db.Exec(query, code, req.Title, req.TargetURL, req.BackgroundColor, req.ForegroundColor, req.Size)
+	domainID, hostname, err := h.resolveDomain(req.DomainID)
+	if err == errUnknownDomain {
+		return nil, http.StatusBadRequest, err
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create QR code"})
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("Could not fetch domain")
 	}
+	pending.domainID, pending.hostname = domainID, hostname
 
-	id, _ := result.LastInsertId()
+	if req.FolderID != nil && *req.FolderID != 0 {
+		if err := h.checkFolder(*req.FolderID); err == errUnknownFolder {
+			return nil, http.StatusBadRequest, err
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("Could not fetch folder")
+		}
+		pending.folderID = sql.NullInt64{Int64: int64(*req.FolderID), Valid: true}
+	}
 
-	// Generate QR code image
-	baseURL := os.Getenv("BASE_URL")
-	redirectURL := fmt.Sprintf("%s/r/%s", baseURL, code)
+	return pending, http.StatusOK, nil
+}
 
-	qr, err := qrcode.New(redirectURL, qrcode.Medium)
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertQRCode stores a prepared QR code under a new unique code. Its
+// image is left to the caller.
+func insertQRCode(db execer, pending *pendingQR) (models.QRCode, error) {
+	req := &pending.req
+	code, err := generateUniqueCode()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR image"})
-		return
+		return models.QRCode{}, err
+	}
+
+	expiresAt := requestExpiry(req)
+	query := `INSERT INTO qr_codes (code, title, target_url, background_color, foreground_color, size, retention_days, analytics_sinks,
+			  utm_source, utm_medium, utm_campaign, utm_term, utm_content, timezone, expires_at, expired_url, track_conversions,
+			  access_mode, password_hash, max_scans, domain_id, payload_type, payload, dynamic, bulk_job_id,
+			  folder_id, metadata) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, code, req.Title, req.TargetURL, req.BackgroundColor, req.ForegroundColor, req.Size,
+		req.RetentionDays, formatSinkList(req.AnalyticsSinks),
+		req.Source, req.Medium, req.Campaign, req.Term, req.Content,
+		nullString(req.Timezone), formatDBTime(expiresAt), nullString(req.ExpiredURL), req.TrackConversions,
+		req.AccessMode, pending.passwordHash, req.MaxScans, pending.domainID, req.PayloadType, nullString(string(req.Payload)), *req.Dynamic,
+		pending.bulkJobID, pending.folderID, metadataValue(req.Metadata))
+	if err != nil {
+		return models.QRCode{}, err
 	}
 
-	// Create QR code directory if it doesn't exist
-	os.MkdirAll("./data/qr_images", 0755)
+	id, _ := result.LastInsertId()
+	if err := setQRTags(db, int(id), req.Tags); err != nil {
+		return models.QRCode{}, err
+	}
 
-	imagePath := fmt.Sprintf("./data/qr_images/%s.png", code)
-	err = qr.WriteFile(req.Size, imagePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save QR image"})
+	qrCode := models.QRCode{
+		ID:               int(id),
+		Code:             code,
+		Title:            req.Title,
+		TargetURL:        req.TargetURL,
+		BackgroundColor:  req.BackgroundColor,
+		ForegroundColor:  req.ForegroundColor,
+		Size:             req.Size,
+		RetentionDays:    req.RetentionDays,
+		AnalyticsSinks:   req.AnalyticsSinks,
+		UTMParams:        req.UTMParams,
+		Timezone:         req.Timezone,
+		ExpiresAt:        expiresAt,
+		ExpiredURL:       req.ExpiredURL,
+		TrackConversions: req.TrackConversions,
+		AccessMode:       req.AccessMode,
+		MaxScans:         req.MaxScans,
+		Status:           statusActive,
+		PayloadType:      req.PayloadType,
+		Payload:          req.Payload,
+		Dynamic:          *req.Dynamic,
+		Tags:             req.Tags,
+		Metadata:         metadataField(req.Metadata),
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+	if pending.domainID.Valid {
+		domain := int(pending.domainID.Int64)
+		qrCode.DomainID = &domain
+	}
+	if pending.folderID.Valid {
+		folder := int(pending.folderID.Int64)
+		qrCode.FolderID = &folder
+	}
+	setContent(&qrCode, pending.hostname)
+	return qrCode, nil
+}
+
+// setContent fills in whether a QR code is dynamic and the content its
+// image encodes: its short URL, or its static payload. qr.Dynamic holds the
+// stored flag on entry.
+func setContent(qr *models.QRCode, hostname string) {
+	qr.Dynamic = payload.Dynamic(qr.PayloadType, qr.Dynamic)
+	if qr.Dynamic {
+		qr.ShortURL = shortURL(qr.Code, hostname)
+		qr.Content = qr.ShortURL
 		return
 	}
+	qr.Content, _ = payload.Encode(qr.PayloadType, qr.Payload)
+}
 
-	qrCode := models.QRCode{
-		ID:              int(id),
-		Code:            code,
-		Title:           req.Title,
-		TargetURL:       req.TargetURL,
-		BackgroundColor: req.BackgroundColor,
-		ForegroundColor: req.ForegroundColor,
-		Size:            req.Size,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
+// writeQRImage renders the QR code image encoding url
+func writeQRImage(code, url string, size int) error {
+	qr, err := qrcode.New(url, qrcode.Medium)
+	if err != nil {
+		return err
 	}
 
-	c.JSON(http.StatusOK, qrCode)
+	// Create QR code directory if it doesn't exist
+	os.MkdirAll("./data/qr_images", 0755)
+
+	imagePath := fmt.Sprintf("./data/qr_images/%s.png", code)
+	return qr.WriteFile(size, imagePath)
 }
 
 func generateUniqueCode() (string, error) {
@@ -149,18 +289,143 @@ func generateUniqueCode() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// qrCodeColumns lists the qr_codes columns read by scanQRCode, using the
+// "q" alias shared by the queries below
+const qrCodeColumns = `q.id, q.code, q.title, q.target_url, q.background_color, q.foreground_color,
+	q.size, q.logo_path, q.created_at, q.updated_at, q.retention_days, q.analytics_sinks,
+	q.utm_source, q.utm_medium, q.utm_campaign, q.utm_term, q.utm_content,
+	q.timezone, q.expires_at, q.expired_url, q.track_conversions, q.access_mode, q.max_scans, q.redirect_count, q.status, q.quarantine_reason,
+	q.domain_id, (SELECT hostname FROM custom_domains WHERE id = q.domain_id), q.payload_type, q.payload, q.dynamic,
+	q.folder_id, q.metadata, (SELECT group_concat(t.name, char(31)) FROM qr_code_tags qt JOIN tags t ON t.id = qt.tag_id WHERE qt.qr_code_id = q.id)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanQRCode reads the qrCodeColumns of a row into qr, followed by any
+// extra columns selected after them
+func scanQRCode(row rowScanner, qr *models.QRCode, extra ...interface{}) error {
+	var logoPath sql.NullString
+	var retentionDays sql.NullInt64
+	var analyticsSinks sql.NullString
+	var utm [5]sql.NullString
+	var timezone, expiredURL sql.NullString
+	var expiresAt sql.NullTime
+	var accessMode sql.NullString
+	var maxScans, redirectCount sql.NullInt64
+	var domainID sql.NullInt64
+	var hostname, quarantineReason sql.NullString
+	var payloadType, payloadFields sql.NullString
+	var folderID sql.NullInt64
+	var metadata, tags sql.NullString
+	dest := []interface{}{&qr.ID, &qr.Code, &qr.Title, &qr.TargetURL, &qr.BackgroundColor,
+		&qr.ForegroundColor, &qr.Size, &logoPath, &qr.CreatedAt, &qr.UpdatedAt, &retentionDays, &analyticsSinks,
+		&utm[0], &utm[1], &utm[2], &utm[3], &utm[4], &timezone, &expiresAt, &expiredURL, &qr.TrackConversions,
+		&accessMode, &maxScans, &redirectCount, &qr.Status, &quarantineReason,
+		&domainID, &hostname, &payloadType, &payloadFields, &qr.Dynamic,
+		&folderID, &metadata, &tags}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	if logoPath.Valid {
+		qr.LogoPath = logoPath.String
+	}
+	if retentionDays.Valid {
+		days := int(retentionDays.Int64)
+		qr.RetentionDays = &days
+	}
+	qr.AnalyticsSinks = parseSinkList(analyticsSinks)
+	qr.UTMParams = models.UTMParams{
+		Source:   utm[0].String,
+		Medium:   utm[1].String,
+		Campaign: utm[2].String,
+		Term:     utm[3].String,
+		Content:  utm[4].String,
+	}
+	qr.Timezone = timezone.String
+	if expiresAt.Valid {
+		qr.ExpiresAt = &expiresAt.Time
+	}
+	qr.ExpiredURL = expiredURL.String
+	qr.AccessMode = accessOpen
+	if accessMode.String != "" {
+		qr.AccessMode = accessMode.String
+	}
+	if maxScans.Valid {
+		limit := int(maxScans.Int64)
+		qr.MaxScans = &limit
+	}
+	qr.RedirectCount = int(redirectCount.Int64)
+	qr.QuarantineReason = quarantineReason.String
+	if domainID.Valid {
+		domain := int(domainID.Int64)
+		qr.DomainID = &domain
+	}
+	qr.PayloadType = payload.URL
+	if payloadType.String != "" {
+		qr.PayloadType = payloadType.String
+	}
+	if payloadFields.Valid {
+		qr.Payload = json.RawMessage(payloadFields.String)
+	}
+	if folderID.Valid {
+		folder := int(folderID.Int64)
+		qr.FolderID = &folder
+	}
+	if metadata.Valid {
+		qr.Metadata = json.RawMessage(metadata.String)
+	}
+	if tags.String != "" {
+		qr.Tags = strings.Split(tags.String, tagsSeparator)
+		sort.Strings(qr.Tags)
+	}
+	setContent(qr, hostname.String)
+	return nil
+}
+
+// parseSinkList decodes the analytics_sinks column. NULL enables every
+// configured sink and is returned as nil; an empty string disables them all.
+func parseSinkList(value sql.NullString) []string {
+	if !value.Valid {
+		return nil
+	}
+	if value.String == "" {
+		return []string{}
+	}
+	return strings.Split(value.String, ",")
+}
+
+func formatSinkList(names []string) sql.NullString {
+	if names == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.Join(names, ","), Valid: true}
+}
+
 func (h *Handler) ListQR(c *gin.Context) {
+	filter, args, ok := statusFilter(c.Query("status"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, paused, archived or all"})
+		return
+	}
+	scope, scopeArgs, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	args = append(args, scopeArgs...)
+
 	query := `
-		SELECT q.id, q.code, q.title, q.target_url, q.background_color, q.foreground_color, 
-			   q.size, q.logo_path, q.created_at, q.updated_at, COALESCE(COUNT(s.id), 0) as total_scans
-		FROM qr_codes q 
-		LEFT JOIN qr_scans s ON q.id = s.qr_code_id 
-		GROUP BY q.id, q.code, q.title, q.target_url, q.background_color, q.foreground_color, 
-				 q.size, q.logo_path, q.created_at, q.updated_at
+		SELECT ` + qrCodeColumns + `, COALESCE(c.scans, 0) as total_scans,
+			   COALESCE(c.unique_scans, 0) as unique_scans
+		FROM qr_codes q
+		` + scanTotals + `
+		WHERE q.deleted_at IS NULL AND ` + filter + ` AND ` + scope + `
 		ORDER BY q.created_at DESC
 	`
 
-	rows, err := h.db.Query(query)
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR codes"})
 		return
@@ -170,15 +435,9 @@ func (h *Handler) ListQR(c *gin.Context) {
 	var qrCodes []models.QRCode
 	for rows.Next() {
 		var qr models.QRCode
-		var logoPath sql.NullString
-		err := rows.Scan(&qr.ID, &qr.Code, &qr.Title, &qr.TargetURL, &qr.BackgroundColor,
-			&qr.ForegroundColor, &qr.Size, &logoPath, &qr.CreatedAt, &qr.UpdatedAt, &qr.TotalScans)
-		if err != nil {
+		if err := scanQRCode(rows, &qr, &qr.TotalScans, &qr.UniqueScans); err != nil {
 			continue
 		}
-		if logoPath.Valid {
-			qr.LogoPath = logoPath.String
-		}
 		qrCodes = append(qrCodes, qr)
 	}
 
@@ -194,19 +453,16 @@ func (h *Handler) GetQR(c *gin.Context) {
 	id := c.Param("id")
 
 	query := `
-		SELECT q.id, q.code, q.title, q.target_url, q.background_color, q.foreground_color, 
-			   q.size, q.logo_path, q.created_at, q.updated_at, COALESCE(COUNT(s.id), 0) as total_scans
-		FROM qr_codes q 
-		LEFT JOIN qr_scans s ON q.id = s.qr_code_id 
-		WHERE q.id = ?
-		GROUP BY q.id, q.code, q.title, q.target_url, q.background_color, q.foreground_color, 
-				 q.size, q.logo_path, q.created_at, q.updated_at
+		SELECT ` + qrCodeColumns + `, COALESCE(SUM(c.scans), 0) as total_scans,
+			   COALESCE(SUM(c.unique_scans), 0) as unique_scans
+		FROM qr_codes q
+		LEFT JOIN ` + rollups.Counts(rollups.Total) + ` c ON c.qr_code_id = q.id
+		WHERE q.id = ? AND q.deleted_at IS NULL
+		GROUP BY q.id
 	`
 
 	var qr models.QRCode
-	var logoPath sql.NullString
-	err := h.db.QueryRow(query, id).Scan(&qr.ID, &qr.Code, &qr.Title, &qr.TargetURL,
-		&qr.BackgroundColor, &qr.ForegroundColor, &qr.Size, &logoPath, &qr.CreatedAt, &qr.UpdatedAt, &qr.TotalScans)
+	err := scanQRCode(h.db.QueryRow(query, id), &qr, &qr.TotalScans, &qr.UniqueScans)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
@@ -217,26 +473,152 @@ func (h *Handler) GetQR(c *gin.Context) {
 		return
 	}
 
-	if logoPath.Valid {
-		qr.LogoPath = logoPath.String
-	}
-
 	c.JSON(http.StatusOK, qr)
 }
 
+// updateRequest returns the stored fields of a QR code as an update
+// request, so fields left out of an update keep their values. Tags, folder,
+// domain and metadata are left nil, which the update keeps as well.
+func updateRequest(qr models.QRCode) models.CreateQRRequest {
+	req := models.CreateQRRequest{
+		Title:            qr.Title,
+		TargetURL:        qr.TargetURL,
+		BackgroundColor:  qr.BackgroundColor,
+		ForegroundColor:  qr.ForegroundColor,
+		Size:             qr.Size,
+		RetentionDays:    qr.RetentionDays,
+		AnalyticsSinks:   qr.AnalyticsSinks,
+		UTMParams:        qr.UTMParams,
+		Timezone:         qr.Timezone,
+		ExpiredURL:       qr.ExpiredURL,
+		TrackConversions: qr.TrackConversions,
+		AccessMode:       qr.AccessMode,
+		MaxScans:         qr.MaxScans,
+		PayloadType:      qr.PayloadType,
+		Payload:          qr.Payload,
+	}
+	if qr.ExpiresAt != nil {
+		req.ExpiresAt = qr.ExpiresAt.Format(time.RFC3339)
+	}
+	return req
+}
+
 func (h *Handler) UpdateQR(c *gin.Context) {
 	id := c.Param("id")
-	var req models.CreateQRRequest
+	var stored models.QRCode
+	err := scanQRCode(h.db.QueryRow(`SELECT `+qrCodeColumns+` FROM qr_codes q WHERE q.id = ? AND q.deleted_at IS NULL`, id), &stored)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR code"})
+		return
+	}
+
+	// The request is decoded over the stored fields, so it only changes the
+	// fields it gives
+	req := updateRequest(stored)
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.BackgroundColor == "" {
+		req.BackgroundColor = stored.BackgroundColor
+	}
+	if req.ForegroundColor == "" {
+		req.ForegroundColor = stored.ForegroundColor
+	}
+	if req.Size == 0 {
+		req.Size = stored.Size
+	}
+
+	// The payload type and whether the code is dynamic decide what the
+	// printed image encodes, so they can't change
+	if req.PayloadType == "" {
+		req.PayloadType = stored.PayloadType
+	} else if req.PayloadType != stored.PayloadType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payload_type can't be changed after creation"})
+		return
+	}
+	dynamic := payload.Dynamic(stored.PayloadType, stored.Dynamic)
+	if req.Dynamic == nil {
+		req.Dynamic = &dynamic
+	}
+
+	if err := h.validateQRRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.Dynamic != dynamic {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dynamic can't be changed after creation"})
+		return
+	}
+
+	// Protected codes keep their password unless a new one is given
+	var passwordHash sql.NullString
+	if req.AccessMode == accessPassword {
+		if req.Password != "" {
+			hash, err := hashAccessPassword(req.Password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+				return
+			}
+			passwordHash = hash
+		} else {
+			var hasPassword bool
+			if err := h.db.QueryRow("SELECT password_hash IS NOT NULL FROM qr_codes WHERE id = ?", id).Scan(&hasPassword); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR code"})
+				return
+			}
+			if !hasPassword {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "password is required with the password access mode"})
+				return
+			}
+		}
+	}
+
+	if req.DomainID != nil {
+		if _, _, err := h.resolveDomain(req.DomainID); err == errUnknownDomain {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch domain"})
+			return
+		}
+		if err := h.keepPreviousDomain(id, *req.DomainID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update domain"})
+			return
+		}
+	}
+	if req.FolderID != nil && *req.FolderID != 0 {
+		if err := h.checkFolder(*req.FolderID); err == errUnknownFolder {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch folder"})
+			return
+		}
+	}
 
 	query := `UPDATE qr_codes SET title = ?, target_url = ?, background_color = ?, 
-			  foreground_color = ?, size = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+			  foreground_color = ?, size = ?, retention_days = ?, analytics_sinks = ?,
+			  utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_term = ?, utm_content = ?,
+			  timezone = ?, expires_at = ?, expired_url = ?, track_conversions = ?,
+			  redirect_count = CASE WHEN access_mode IS ? AND max_scans IS ? THEN redirect_count ELSE 0 END,
+			  access_mode = ?, max_scans = ?,
+			  password_hash = CASE WHEN ? = 'password' THEN COALESCE(?, password_hash) END,
+			  domain_id = CASE WHEN ? IS NULL THEN domain_id ELSE NULLIF(?, 0) END, payload_type = ?, payload = ?, dynamic = ?,
+			  folder_id = CASE WHEN ? IS NULL THEN folder_id ELSE NULLIF(?, 0) END,
+			  metadata = CASE WHEN ? THEN ? ELSE metadata END,
+			  updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`
 
 	result, err := h.db.Exec(query, req.Title, req.TargetURL, req.BackgroundColor,
-		req.ForegroundColor, req.Size, id)
+		req.ForegroundColor, req.Size, req.RetentionDays, formatSinkList(req.AnalyticsSinks),
+		req.Source, req.Medium, req.Campaign, req.Term, req.Content,
+		nullString(req.Timezone), formatDBTime(requestExpiry(&req)), nullString(req.ExpiredURL), req.TrackConversions,
+		req.AccessMode, req.MaxScans, req.AccessMode, req.MaxScans, req.AccessMode, passwordHash, req.DomainID, req.DomainID,
+		req.PayloadType, nullString(string(req.Payload)), *req.Dynamic, req.FolderID, req.FolderID,
+		req.Metadata != nil, metadataValue(req.Metadata), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update QR code"})
 		return
@@ -248,26 +630,32 @@ func (h *Handler) UpdateQR(c *gin.Context) {
 		return
 	}
 
+	if req.Tags != nil {
+		qrID, _ := strconv.Atoi(id)
+		if err := setQRTags(h.db, qrID, req.Tags); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update tags"})
+			return
+		}
+	}
+
+	// Regenerate the image so it encodes the code's current content and size
+	var qr models.QRCode
+	if err := scanQRCode(h.db.QueryRow(`SELECT `+qrCodeColumns+` FROM qr_codes q WHERE q.id = ?`, id), &qr); err == nil {
+		if err := writeQRImage(qr.Code, qr.Content, qr.Size); err != nil {
+			log.Printf("Error regenerating QR image: %v", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "QR code updated successfully"})
 }
 
+// DeleteQR moves a QR code to the trash. It stops redirecting but keeps its
+// scans, image and code until it is restored or purged.
 func (h *Handler) DeleteQR(c *gin.Context) {
 	id := c.Param("id")
 
-	// Get the QR code to delete associated files
-	var code string
-	err := h.db.QueryRow("SELECT code FROM qr_codes WHERE id = ?", id).Scan(&code)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR code"})
-		return
-	}
-
-	// Delete from database
-	result, err := h.db.Exec("DELETE FROM qr_codes WHERE id = ?", id)
+	result, err := h.db.Exec(`UPDATE qr_codes SET deleted_at = CURRENT_TIMESTAMP
+							  WHERE id = ? AND deleted_at IS NULL`, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete QR code"})
 		return
@@ -279,20 +667,21 @@ func (h *Handler) DeleteQR(c *gin.Context) {
 		return
 	}
 
-	// Delete associated image file
-	imagePath := fmt.Sprintf("./data/qr_images/%s.png", code)
-	os.Remove(imagePath)
-
 	c.JSON(http.StatusOK, gin.H{"message": "QR code deleted successfully"})
 }
 
 func (h *Handler) RedirectQR(c *gin.Context) {
 	code := c.Param("code")
 
-	// Get QR code details
-	var qrID int
-	var targetURL string
-	err := h.db.QueryRow("SELECT id, target_url FROM qr_codes WHERE code = ?", code).Scan(&qrID, &targetURL)
+	// Get QR code details. On a custom domain, only its own codes resolve.
+	query := `SELECT ` + qrCodeColumns + ` FROM qr_codes q WHERE q.code = ? AND q.deleted_at IS NULL`
+	args := []interface{}{code}
+	if domainID, ok := c.Get(domainContextKey); ok {
+		query += ` AND (q.domain_id = ? OR q.id IN (SELECT qr_code_id FROM qr_code_domains WHERE domain_id = ?))`
+		args = append(args, domainID, domainID)
+	}
+	var qr models.QRCode
+	err := scanQRCode(h.db.QueryRow(query, args...), &qr)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
 		return
@@ -302,67 +691,148 @@ func (h *Handler) RedirectQR(c *gin.Context) {
 		return
 	}
 
-	// Get client information
-	clientIP := utils.GetClientIP(c.Request)
-	userAgent := c.GetHeader("User-Agent")
-	browser, deviceType := utils.ParseUserAgent(userAgent)
+	// Static codes encode their payload and never come through here
+	if !qr.Dynamic {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
+		return
+	}
+
+	qrID := qr.ID
+	scan := h.inspectScan(c.Request)
+	now := time.Now()
+
+	// Paused, quarantined and archived codes log the attempt but don't
+	// redirect
+	switch qr.Status {
+	case statusPaused, statusQuarantined:
+		scan.EventType = qr.Status
+		h.recordScan(qrID, scan)
+		h.renderPaused(c, qr)
+		return
+	case statusArchived:
+		scan.EventType = eventArchived
+		h.recordScan(qrID, scan)
+		serveGone(c, qr, "QR code has been archived")
+		return
+	}
+
+	// Expired codes go to the expired page, or are gone
+	if qr.ExpiresAt != nil && !now.Before(*qr.ExpiresAt) {
+		scan.EventType = eventExpired
+		h.recordScan(qrID, scan)
+		serveGone(c, qr, "QR code has expired")
+		return
+	}
+
+	// Protected codes ask for their password first. The download link of a
+	// contact page is only issued once it was given.
+	if qr.AccessMode == accessPassword && !vcfDownload(c, qr, now) && !h.checkAccessPassword(c, qrID) {
+		return
+	}
+
+	// Dynamic vCard codes land on their contact page
+	if qr.PayloadType == payload.VCard {
+		h.serveContact(c, qr, scan)
+		return
+	}
+
+	// Pick the target URL from the first matching redirect rule, then the
+	// active schedule entry, then a split-test variant, then the default
+	targetURL := qr.TargetURL
+	if rule, err := h.matchRedirectRule(qrID, scan); err != nil {
+		log.Printf("Error evaluating redirect rules: %v", err)
+	} else if rule != nil {
+		targetURL = rule.TargetURL
+		scan.RuleID = sql.NullInt64{Int64: int64(rule.ID), Valid: true}
+	}
+	scheduled := ""
+	if !scan.RuleID.Valid {
+		var err error
+		if scheduled, err = h.scheduledTarget(qrID, now); err != nil {
+			log.Printf("Error evaluating schedule: %v", err)
+		} else if scheduled != "" {
+			targetURL = scheduled
+		}
+	}
+
+	// Split-test variants replace the default target
+	if !scan.RuleID.Valid && scheduled == "" {
+		if variant, err := h.pickVariant(c, qr, scan); err != nil {
+			log.Printf("Error picking variant: %v", err)
+		} else if variant != nil {
+			targetURL = variant.TargetURL
+			scan.VariantID = sql.NullInt64{Int64: int64(variant.ID), Valid: true}
+		}
+	}
+
+	// Targets that no longer pass the URL policy quarantine the code
+	if err := h.safety.Check(targetURL); err != nil {
+		h.quarantine(qrID, fmt.Sprintf("%s: %v", targetURL, err))
+		scan.EventType = eventQuarantined
+		h.recordScan(qrID, scan)
+		h.renderPaused(c, qr)
+		return
+	}
+	targetURL = utils.AppendUTM(targetURL, qr.UTMParams)
 
-	// Get geolocation
-	country, city, _ := utils.GetGeolocation(clientIP)
+	// Count the redirect, refusing it once a limited code is used up
+	if allowed, err := h.consumeRedirect(qr); err != nil {
+		log.Printf("Error counting redirect: %v", err)
+		if scanLimit(qr) > 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	} else if !allowed {
+		scan.EventType = eventLimitReached
+		h.recordScan(qrID, scan)
+		serveGone(c, qr, "QR code has reached its scan limit")
+		return
+	}
 
 	// Record the scan
-	scanQuery := `INSERT INTO qr_scans (qr_code_id, ip_address, user_agent, country, city, browser, device_type) 
-				  VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err = h.db.Exec(scanQuery, qrID, clientIP, userAgent, country, city, browser, deviceType)
-	if err != nil {
-		// Log error but don't fail the redirect
-		fmt.Printf("Error recording scan: %v\n", err)
+	scanID := h.recordScan(qrID, scan)
+
+	// Pass a signed click ID on so the target site can report conversions
+	if qr.TrackConversions && !scan.Private && scanID > 0 && clickIDSecret() != "" {
+		targetURL = utils.AppendQueryParam(targetURL, clickIDParam, signClickID(scanID))
 	}
 
-	// Generate GTM tracking script if GTM_ID is configured
+	// Forward the scan to the server-side analytics sinks, with the client IP
+	// only when it's stored as an address rather than a hash
+	if !scan.Private {
+		clientIP := scan.StoredIP
+		if net.ParseIP(clientIP) == nil {
+			clientIP = ""
+		}
+		h.sinks.Dispatch(sinks.Event{
+			Name:       "qr_code_scan",
+			QRCodeID:   qrID,
+			Code:       code,
+			ScanURL:    qr.ShortURL,
+			TargetURL:  targetURL,
+			VisitorID:  scan.VisitorHash,
+			ClientIP:   clientIP,
+			UserAgent:  scan.UserAgent,
+			Browser:    scan.Browser,
+			DeviceType: scan.DeviceType,
+			Country:    scan.Country,
+			City:       scan.City,
+			Time:       time.Now(),
+		}, qr.AnalyticsSinks)
+	}
+
+	// Serve the GTM tracking page if GTM_ID is configured, unless the client
+	// asked not to be tracked
 	gtmID := os.Getenv("GTM_ID")
-	if gtmID != "" {
-		// Return an HTML page with GTM tracking and redirect
-		html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <!-- Google Tag Manager -->
-    <script>(function(w,d,s,l,i){w[l]=w[l]||[];w[l].push({'gtm.start':
-    new Date().getTime(),event:'gtm.js'});var f=d.getElementsByTagName(s)[0],
-    j=d.createElement(s),dl=l!='dataLayer'?'&l='+l:'';j.async=true;j.src=
-    'https://www.googletagmanager.com/gtm.js?id='+i+dl;f.parentNode.insertBefore(j,f);
-    })(window,document,'script','dataLayer','%s');</script>
-    <!-- End Google Tag Manager -->
-    <script>
-        // Send GTM event
-        window.dataLayer = window.dataLayer || [];
-        window.dataLayer.push({
-            'event': 'qr_code_scan',
-            'qr_code_id': '%d',
-            'qr_code': '%s',
-            'target_url': '%s',
-            'device_type': '%s',
-            'browser': '%s'
-        });
-        
-        // Redirect after a short delay
-        setTimeout(function() {
-            window.location.href = '%s';
-        }, 100);
-    </script>
-</head>
-<body>
-    <!-- Google Tag Manager (noscript) -->
-    <noscript><iframe src="https://www.googletagmanager.com/ns.html?id=%s"
-    height="0" width="0" style="display:none;visibility:hidden"></iframe></noscript>
-    <!-- End Google Tag Manager (noscript) -->
-    <p>Redirecting...</p>
-</body>
-</html>`, gtmID, qrID, code, targetURL, deviceType, browser, targetURL, gtmID)
-
-		c.Header("Content-Type", "text/html")
-		c.String(http.StatusOK, html)
+	if gtmID != "" && !scan.Private && isWebURL(targetURL) {
+		h.renderInterstitial(c, interstitialData{
+			GTMID:      gtmID,
+			QRID:       qrID,
+			Code:       code,
+			TargetURL:  targetURL,
+			DeviceType: scan.DeviceType,
+			Browser:    scan.Browser,
+		})
 		return
 	}
 
@@ -372,21 +842,30 @@ func (h *Handler) RedirectQR(c *gin.Context) {
 
 func (h *Handler) GetAnalyticsOverview(c *gin.Context) {
 	var overview models.AnalyticsOverview
+	scope, args, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Total QR codes
-	h.db.QueryRow("SELECT COUNT(*) FROM qr_codes").Scan(&overview.TotalQRCodes)
-
-	// Total scans
-	h.db.QueryRow("SELECT COUNT(*) FROM qr_scans").Scan(&overview.TotalScans)
-
-	// Scans today
-	h.db.QueryRow("SELECT COUNT(*) FROM qr_scans WHERE DATE(scanned_at) = DATE('now')").Scan(&overview.ScansToday)
-
-	// Scans this week
-	h.db.QueryRow("SELECT COUNT(*) FROM qr_scans WHERE DATE(scanned_at) >= DATE('now', '-7 days')").Scan(&overview.ScansThisWeek)
-
-	// Scans this month
-	h.db.QueryRow("SELECT COUNT(*) FROM qr_scans WHERE DATE(scanned_at) >= DATE('now', 'start of month')").Scan(&overview.ScansThisMonth)
+	h.db.QueryRow("SELECT COUNT(*) FROM qr_codes q WHERE q.deleted_at IS NULL AND "+scope, args...).Scan(&overview.TotalQRCodes)
+
+	// Scans and unique scans, in total, today, this week and this month.
+	// Unique scans count distinct visitors per code and day, as visitor
+	// hashes rotate daily.
+	h.db.QueryRow(`SELECT COALESCE(SUM(scans), 0), COALESCE(SUM(unique_scans), 0),
+		COALESCE(SUM(CASE WHEN day = DATE('now') THEN scans END), 0),
+		COALESCE(SUM(CASE WHEN day = DATE('now') THEN unique_scans END), 0),
+		COALESCE(SUM(CASE WHEN day >= DATE('now', '-7 days') THEN scans END), 0),
+		COALESCE(SUM(CASE WHEN day >= DATE('now', '-7 days') THEN unique_scans END), 0),
+		COALESCE(SUM(CASE WHEN day >= DATE('now', 'start of month') THEN scans END), 0),
+		COALESCE(SUM(CASE WHEN day >= DATE('now', 'start of month') THEN unique_scans END), 0)
+		FROM `+scanCounts(rollups.Total, scope), args...).Scan(
+		&overview.TotalScans, &overview.UniqueScans,
+		&overview.ScansToday, &overview.UniqueScansToday,
+		&overview.ScansThisWeek, &overview.UniqueScansThisWeek,
+		&overview.ScansThisMonth, &overview.UniqueScansThisMonth)
 
 	c.JSON(http.StatusOK, overview)
 }
@@ -396,11 +875,8 @@ func (h *Handler) GetQRAnalytics(c *gin.Context) {
 
 	// Get QR code details
 	var qr models.QRCode
-	var logoPath sql.NullString
-	qrQuery := `SELECT id, code, title, target_url, background_color, foreground_color, 
-				 size, logo_path, created_at, updated_at FROM qr_codes WHERE id = ?`
-	err := h.db.QueryRow(qrQuery, id).Scan(&qr.ID, &qr.Code, &qr.Title, &qr.TargetURL,
-		&qr.BackgroundColor, &qr.ForegroundColor, &qr.Size, &logoPath, &qr.CreatedAt, &qr.UpdatedAt)
+	qrQuery := `SELECT ` + qrCodeColumns + ` FROM qr_codes q WHERE q.id = ? AND q.deleted_at IS NULL`
+	err := scanQRCode(h.db.QueryRow(qrQuery, id), &qr)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
@@ -411,18 +887,13 @@ func (h *Handler) GetQRAnalytics(c *gin.Context) {
 		return
 	}
 
-	if logoPath.Valid {
-		qr.LogoPath = logoPath.String
-	}
-
-	// Get total scans
-	var totalScans int
-	h.db.QueryRow("SELECT COUNT(*) FROM qr_scans WHERE qr_code_id = ?", id).Scan(&totalScans)
+	// Get total and unique scans
+	var totalScans, uniqueScans int
+	h.db.QueryRow("SELECT COALESCE(SUM(scans), 0), COALESCE(SUM(unique_scans), 0) FROM "+rollups.Counts(rollups.Total)+" c WHERE qr_code_id = ?", id).Scan(&totalScans, &uniqueScans)
 
 	// Get recent scans
-	recentScansQuery := `SELECT id, qr_code_id, ip_address, user_agent, country, city, 
-						 browser, device_type, scanned_at FROM qr_scans 
-						 WHERE qr_code_id = ? ORDER BY scanned_at DESC LIMIT 10`
+	recentScansQuery := `SELECT ` + qrScanColumns + ` FROM qr_scans
+						 WHERE qr_code_id = ? ORDER BY scanned_at DESC, id DESC LIMIT 10`
 	rows, err := h.db.Query(recentScansQuery, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch recent scans"})
@@ -433,34 +904,19 @@ func (h *Handler) GetQRAnalytics(c *gin.Context) {
 	var recentScans []models.QRScan
 	for rows.Next() {
 		var scan models.QRScan
-		var country, city, browser, deviceType sql.NullString
-		err := rows.Scan(&scan.ID, &scan.QRCodeID, &scan.IPAddress, &scan.UserAgent,
-			&country, &city, &browser, &deviceType, &scan.ScannedAt)
-		if err != nil {
+		if err := scanQRScan(rows, &scan); err != nil {
 			continue
 		}
-		if country.Valid {
-			scan.Country = country.String
-		}
-		if city.Valid {
-			scan.City = city.String
-		}
-		if browser.Valid {
-			scan.Browser = browser.String
-		}
-		if deviceType.Valid {
-			scan.DeviceType = deviceType.String
-		}
 		recentScans = append(recentScans, scan)
 	}
 
 	// Get time series data (last 30 days)
 	timeSeriesQuery := `
-		SELECT DATE(scanned_at) as date, COUNT(*) as scans 
-		FROM qr_scans 
-		WHERE qr_code_id = ? AND scanned_at >= DATE('now', '-30 days')
-		GROUP BY DATE(scanned_at) 
-		ORDER BY date
+		SELECT day, SUM(scans) as scans, SUM(unique_scans) as unique_scans
+		FROM ` + rollups.Counts(rollups.Total) + ` c
+		WHERE qr_code_id = ? AND day >= DATE('now', '-30 days')
+		GROUP BY day
+		ORDER BY day
 	`
 	timeRows, err := h.db.Query(timeSeriesQuery, id)
 	if err != nil {
@@ -472,13 +928,26 @@ func (h *Handler) GetQRAnalytics(c *gin.Context) {
 	var timeSeries []models.TimeSeriesData
 	for timeRows.Next() {
 		var ts models.TimeSeriesData
-		err := timeRows.Scan(&ts.Date, &ts.Scans)
+		err := timeRows.Scan(&ts.Date, &ts.Scans, &ts.UniqueScans)
 		if err != nil {
 			continue
 		}
 		timeSeries = append(timeSeries, ts)
 	}
 
+	// Get conversions
+	var conversions, convertedScans int
+	var conversionValue float64
+	h.db.QueryRow("SELECT COUNT(*), COUNT(DISTINCT scan_id), COALESCE(SUM(value), 0) FROM qr_conversions WHERE qr_code_id = ?", id).
+		Scan(&conversions, &convertedScans, &conversionValue)
+
+	// Get the split-test breakdown
+	variants, err := h.variantAnalytics(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch variant analytics"})
+		return
+	}
+
 	// Ensure we return empty arrays instead of null
 	if recentScans == nil {
 		recentScans = []models.QRScan{}
@@ -490,45 +959,58 @@ func (h *Handler) GetQRAnalytics(c *gin.Context) {
 	analytics := models.QRAnalytics{
 		QRCode:      qr,
 		TotalScans:  totalScans,
+		UniqueScans: uniqueScans,
+
+		Conversions:     conversions,
+		ConversionRate:  conversionRate(convertedScans, totalScans),
+		ConversionValue: conversionValue,
+
 		RecentScans: recentScans,
 		TimeSeries:  timeSeries,
+		Variants:    variants,
 	}
 
 	c.JSON(http.StatusOK, analytics)
 }
 
-func (h *Handler) GetTimeSeriesData(c *gin.Context) {
-	days := c.DefaultQuery("days", "30")
+func (h *Handler) GetCampaignAnalytics(c *gin.Context) {
+	scope, args, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	query := fmt.Sprintf(`
-		SELECT DATE(scanned_at) as date, COUNT(*) as scans 
-		FROM qr_scans 
-		WHERE scanned_at >= DATE('now', '-%s days')
-		GROUP BY DATE(scanned_at) 
-		ORDER BY date
-	`, days)
+	query := `
+		SELECT COALESCE(q.utm_campaign, '') as campaign, COUNT(DISTINCT q.id) as qr_codes,
+			   COALESCE(SUM(c.scans), 0) as total_scans, COALESCE(SUM(c.unique_scans), 0) as unique_scans
+		FROM qr_codes q
+		` + scanTotals + `
+		WHERE q.deleted_at IS NULL AND ` + scope + `
+		GROUP BY campaign
+		ORDER BY total_scans DESC
+	`
 
-	rows, err := h.db.Query(query)
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch time series data"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch campaign analytics"})
 		return
 	}
 	defer rows.Close()
 
-	var timeSeries []models.TimeSeriesData
+	var campaigns []models.CampaignAnalytics
 	for rows.Next() {
-		var ts models.TimeSeriesData
-		err := rows.Scan(&ts.Date, &ts.Scans)
+		var campaign models.CampaignAnalytics
+		err := rows.Scan(&campaign.Campaign, &campaign.QRCodes, &campaign.TotalScans, &campaign.UniqueScans)
 		if err != nil {
 			continue
 		}
-		timeSeries = append(timeSeries, ts)
+		campaigns = append(campaigns, campaign)
 	}
 
 	// Ensure we return an empty array instead of null
-	if timeSeries == nil {
-		timeSeries = []models.TimeSeriesData{}
+	if campaigns == nil {
+		campaigns = []models.CampaignAnalytics{}
 	}
 
-	c.JSON(http.StatusOK, timeSeries)
+	c.JSON(http.StatusOK, campaigns)
 }
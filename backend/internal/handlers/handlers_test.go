@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSinkListRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		names []string
+	}{
+		{"every configured sink", nil},
+		{"no sink", []string{}},
+		{"selected sinks", []string{"ga4", "webhook"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseSinkList(formatSinkList(tc.names))
+			if !reflect.DeepEqual(got, tc.names) {
+				t.Errorf("round trip of %#v gave %#v", tc.names, got)
+			}
+		})
+	}
+}
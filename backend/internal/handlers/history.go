@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultScanPageSize = 50
+	maxScanPageSize     = 500
+)
+
+// ListQRScans pages through the scans of a QR code, newest first unless
+// sort is "oldest". Pages are picked by (scanned_at, id) from the cursor
+// of the previous page, so they stay stable while new scans come in.
+func (h *Handler) ListQRScans(c *gin.Context) {
+	id := c.Param("id")
+	if !h.qrExists(c, id) {
+		return
+	}
+
+	limit := defaultScanPageSize
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxScanPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxScanPageSize)})
+			return
+		}
+		limit = n
+	}
+
+	order, before := "DESC", "<"
+	switch c.DefaultQuery("sort", "newest") {
+	case "newest":
+	case "oldest":
+		order, before = "ASC", ">"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest or oldest"})
+		return
+	}
+
+	conditions := []string{"qr_code_id = ?"}
+	args := []interface{}{id}
+	for _, bound := range []struct{ param, operator string }{{"from", ">="}, {"to", "<"}} {
+		t, err := parseScheduleTime(c.Query(bound.param), time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + ": " + err.Error()})
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "scanned_at "+bound.operator+" ?")
+			args = append(args, formatDBTime(t))
+		}
+	}
+	for _, field := range []string{"country", "device_type", "browser"} {
+		if value := c.Query(field); value != "" {
+			conditions = append(conditions, field+" = ? COLLATE NOCASE")
+			args = append(args, value)
+		}
+	}
+	switch c.Query("bot") {
+	case "":
+	case "true":
+		conditions = append(conditions, "is_bot = 1")
+	case "false":
+		conditions = append(conditions, "is_bot = 0")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bot must be true or false"})
+		return
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		scannedAt, scanID, err := decodeScanCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		conditions = append(conditions, "(scanned_at, id) "+before+" (?, ?)")
+		args = append(args, scannedAt, scanID)
+	}
+
+	// One extra row tells whether another page follows
+	query := `SELECT ` + qrScanColumns + ` FROM qr_scans WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY scanned_at ` + order + `, id ` + order + ` LIMIT ?`
+	rows, err := h.db.Query(query, append(args, limit+1)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch scans"})
+		return
+	}
+	defer rows.Close()
+
+	page := models.QRScanPage{Scans: []models.QRScan{}}
+	for rows.Next() {
+		var scan models.QRScan
+		if err := scanQRScan(rows, &scan); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch scans"})
+			return
+		}
+		page.Scans = append(page.Scans, scan)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch scans"})
+		return
+	}
+
+	if len(page.Scans) > limit {
+		page.Scans = page.Scans[:limit]
+		last := page.Scans[limit-1]
+		page.NextCursor = encodeScanCursor(last.ScannedAt, last.ID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// encodeScanCursor encodes the position of a scan in the history as an
+// opaque token
+func encodeScanCursor(scannedAt time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(scannedAt.UTC().Format(dbTimeFormat) + "|" + strconv.Itoa(id)))
+}
+
+func decodeScanCursor(cursor string) (string, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, err
+	}
+	scannedAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return "", 0, fmt.Errorf("malformed cursor")
+	}
+	if _, err := time.Parse(dbTimeFormat, scannedAt); err != nil {
+		return "", 0, err
+	}
+	scanID, err := strconv.Atoi(id)
+	if err != nil {
+		return "", 0, err
+	}
+	return scannedAt, scanID, nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultInterstitial is the page served while Google Tag Manager records a
+// scan. All values are escaped by html/template for the context they appear
+// in, and every script carries the per-request CSP nonce.
+const defaultInterstitial = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta http-equiv="refresh" content="2;url={{.TargetURL}}">
+    <title>Redirecting...</title>
+    <!-- Google Tag Manager -->
+    <script nonce="{{.Nonce}}">(function(w,d,s,l,i){w[l]=w[l]||[];w[l].push({'gtm.start':
+    new Date().getTime(),event:'gtm.js'});var f=d.getElementsByTagName(s)[0],
+    j=d.createElement(s),dl=l!='dataLayer'?'&l='+l:'';j.async=true;j.src=
+    'https://www.googletagmanager.com/gtm.js?id='+i+dl;j.setAttribute('nonce',{{.Nonce}});
+    f.parentNode.insertBefore(j,f);
+    })(window,document,'script','dataLayer',{{.GTMID}});</script>
+    <!-- End Google Tag Manager -->
+    <script nonce="{{.Nonce}}">
+        // Send GTM event
+        window.dataLayer = window.dataLayer || [];
+        window.dataLayer.push({
+            'event': 'qr_code_scan',
+            'qr_code_id': '{{.QRID}}',
+            'qr_code': {{.Code}},
+            'target_url': {{.TargetURL}},
+            'device_type': {{.DeviceType}},
+            'browser': {{.Browser}}
+        });
+
+        // Redirect after a short delay
+        setTimeout(function() {
+            window.location.href = {{.TargetURL}};
+        }, 100);
+    </script>
+</head>
+<body>
+    <!-- Google Tag Manager (noscript) -->
+    <noscript><iframe src="https://www.googletagmanager.com/ns.html?id={{.GTMID}}"
+    height="0" width="0" style="display:none;visibility:hidden"></iframe></noscript>
+    <!-- End Google Tag Manager (noscript) -->
+    <p>Redirecting... <a href="{{.TargetURL}}">Continue</a></p>
+</body>
+</html>`
+
+// interstitialData is passed to the interstitial template, including custom
+// templates loaded from GTM_TEMPLATE_PATH
+type interstitialData struct {
+	GTMID      string
+	Nonce      string
+	QRID       int
+	Code       string
+	TargetURL  string
+	DeviceType string
+	Browser    string
+}
+
+// loadInterstitial parses the branded template named by GTM_TEMPLATE_PATH,
+// falling back to the built-in page if it is unset or invalid
+func loadInterstitial() *template.Template {
+	if path := os.Getenv("GTM_TEMPLATE_PATH"); path != "" {
+		tmpl, err := template.ParseFiles(path)
+		if err == nil {
+			return tmpl
+		}
+		log.Printf("Could not load GTM template %s, using default: %v", path, err)
+	}
+	return template.Must(template.New("interstitial").Parse(defaultInterstitial))
+}
+
+// renderInterstitial serves the GTM page under a strict Content Security
+// Policy that only allows scripts carrying this response's nonce
+func (h *Handler) renderInterstitial(c *gin.Context, data interstitialData) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		c.Redirect(http.StatusFound, data.TargetURL)
+		return
+	}
+	data.Nonce = base64.StdEncoding.EncodeToString(nonce)
+
+	csp := fmt.Sprintf("default-src 'none'; script-src 'nonce-%s' 'strict-dynamic' https:; "+
+		"img-src https: data:; connect-src https:; frame-src https://www.googletagmanager.com; "+
+		"style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'", data.Nonce)
+
+	var page bytes.Buffer
+	if err := h.interstitial.Execute(&page, data); err != nil {
+		log.Printf("Error rendering GTM page: %v", err)
+		c.Redirect(http.StatusFound, data.TargetURL)
+		return
+	}
+
+	c.Header("Content-Security-Policy", csp)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// isWebURL reports whether target is an absolute http(s) URL, the only kind
+// the interstitial may navigate to
+func isWebURL(target string) bool {
+	u, err := url.Parse(target)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/GridexX/qr-tracker/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// PurgeIPScans deletes every scan recorded from an IP address, stored raw
+// or hashed. Truncated addresses are left alone: they are shared by the
+// whole network, so they can't be tied to the address.
+func (h *Handler) PurgeIPScans(c *gin.Context) {
+	ip := c.Query("ip")
+	if net.ParseIP(ip) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid ip query parameter is required"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM qr_scans WHERE ip_address IN (?, ?)",
+		ip, utils.AnonymizeIP(ip, utils.IPModeHash))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not purge scans"})
+		return
+	}
+
+	deleted, _ := result.RowsAffected()
+	c.JSON(http.StatusOK, gin.H{"message": "Scans purged successfully", "deleted": deleted})
+}
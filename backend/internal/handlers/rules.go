@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetRedirectRules(c *gin.Context) {
+	id := c.Param("id")
+
+	if !h.qrExists(c, id) {
+		return
+	}
+
+	rules, err := h.loadRedirectRules(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch redirect rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// SetRedirectRules replaces the ordered rule list of a QR code
+func (h *Handler) SetRedirectRules(c *gin.Context) {
+	id := c.Param("id")
+	var req models.RedirectRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, rule := range req.Rules {
+		if err := h.checkTargets(rule.TargetURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !h.qrExists(c, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update redirect rules"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM qr_redirect_rules WHERE qr_code_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update redirect rules"})
+		return
+	}
+	for i, rule := range req.Rules {
+		_, err := tx.Exec(`INSERT INTO qr_redirect_rules (qr_code_id, position, field, value, target_url)
+						   VALUES (?, ?, ?, ?, ?)`, id, i, rule.Field, rule.Value, rule.TargetURL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update redirect rules"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update redirect rules"})
+		return
+	}
+
+	rules, err := h.loadRedirectRules(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch redirect rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// qrExists writes a 404 or 500 response and returns false unless the QR
+// code with the given id exists
+func (h *Handler) qrExists(c *gin.Context, id string) bool {
+	var exists int
+	err := h.db.QueryRow("SELECT 1 FROM qr_codes WHERE id = ? AND deleted_at IS NULL", id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR code"})
+		return false
+	}
+	return true
+}
+
+func (h *Handler) loadRedirectRules(qrID interface{}) ([]models.RedirectRule, error) {
+	rows, err := h.db.Query(`SELECT id, position, field, value, target_url FROM qr_redirect_rules
+							 WHERE qr_code_id = ? ORDER BY position`, qrID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.RedirectRule{}
+	for rows.Next() {
+		var rule models.RedirectRule
+		if err := rows.Scan(&rule.ID, &rule.Position, &rule.Field, &rule.Value, &rule.TargetURL); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// matchRedirectRule returns the first rule of the QR code matching the
+// client, or nil if the default target URL applies
+func (h *Handler) matchRedirectRule(qrID int, scan scanInfo) (*models.RedirectRule, error) {
+	rules, err := h.loadRedirectRules(qrID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		if ruleMatches(rules[i], scan) {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ruleMatches reports whether the client matches one of the
+// comma-separated values of the rule. Languages match on the client's
+// preferred language, either exactly or by its primary subtag. Country
+// rules never match private scans, which aren't geolocated.
+func ruleMatches(rule models.RedirectRule, scan scanInfo) bool {
+	var actual string
+	switch rule.Field {
+	case "device_type":
+		actual = scan.DeviceType
+	case "os":
+		actual = scan.OS
+	case "country":
+		actual = scan.Country
+	case "language":
+		if len(scan.Languages) > 0 {
+			actual = scan.Languages[0]
+		}
+	}
+	if actual == "" {
+		return false
+	}
+
+	for _, value := range strings.Split(rule.Value, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.EqualFold(actual, value) {
+			return true
+		}
+		if rule.Field == "language" && strings.HasPrefix(actual, strings.ToLower(value)+"-") {
+			return true
+		}
+	}
+	return false
+}
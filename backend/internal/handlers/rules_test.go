@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+)
+
+func TestPrivateScansSkipCountryRules(t *testing.T) {
+	h := &Handler{db: openTestDB(t)}
+	// Local addresses are geolocated as "Local" without calling the API
+	t.Setenv("IPGEOLOCATION_API_KEY", "key")
+	t.Setenv("HONOR_PRIVACY_SIGNALS", "")
+	rule := models.RedirectRule{Field: "country", Value: "Local", TargetURL: "https://example.com/local"}
+
+	for _, tc := range []struct {
+		name    string
+		header  string
+		country string
+		matches bool
+	}{
+		{"regular scan", "", "Local", true},
+		{"Do-Not-Track", "DNT", "", false},
+		{"Global Privacy Control", "Sec-GPC", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/r/abc", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			if tc.header != "" {
+				r.Header.Set(tc.header, "1")
+			}
+			scan := h.inspectScan(r)
+			if scan.Country != tc.country {
+				t.Errorf("country = %q, want %q", scan.Country, tc.country)
+			}
+			if got := ruleMatches(rule, scan); got != tc.matches {
+				t.Errorf("country rule matches = %v, want %v", got, tc.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/jobs"
+	"github.com/GridexX/qr-tracker/internal/parquet"
+	"github.com/GridexX/qr-tracker/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// scanExportColumns are the columns of a scan export, in order. Visitor
+// hashes are left out: they only back unique scan counts.
+var scanExportColumns = []parquet.Column{
+	{Name: "id", Type: parquet.Int64},
+	{Name: "qr_code_id", Type: parquet.Int64},
+	{Name: "code", Type: parquet.String},
+	{Name: "event_type", Type: parquet.String},
+	{Name: "scanned_at", Type: parquet.Timestamp},
+	{Name: "ip_address", Type: parquet.String, Optional: true},
+	{Name: "user_agent", Type: parquet.String, Optional: true},
+	{Name: "country", Type: parquet.String, Optional: true},
+	{Name: "city", Type: parquet.String, Optional: true},
+	{Name: "browser", Type: parquet.String, Optional: true},
+	{Name: "device_type", Type: parquet.String, Optional: true},
+	{Name: "os", Type: parquet.String, Optional: true},
+	{Name: "referrer", Type: parquet.String, Optional: true},
+	{Name: "rule_id", Type: parquet.Int64, Optional: true},
+	{Name: "variant_id", Type: parquet.Int64, Optional: true},
+}
+
+// scanExportBatch is how many scans are read per query. Batches are
+// picked by scan ID, so no query or result set stays open for long.
+const scanExportBatch = 1000
+
+// rowWriter writes export rows in one of the export formats
+type rowWriter interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+// ExportScans streams every scan matching the filters as CSV, JSON Lines
+// or Parquet. Privacy settings apply to the export as they do to stored
+// scans: IP addresses are anonymized in the configured mode, including
+// those stored before it was set, and scans past their retention period
+// are left out or anonymized even if the retention job hasn't run yet.
+func (h *Handler) ExportScans(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "jsonl":
+		contentType = "application/x-ndjson"
+	case "parquet":
+		contentType = "application/vnd.apache.parquet"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, jsonl or parquet"})
+		return
+	}
+
+	scope, args, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conditions := "q.deleted_at IS NULL AND " + scope
+
+	if qrID := c.Query("qr_id"); qrID != "" {
+		id, err := strconv.Atoi(qrID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "qr_id must be a QR code ID"})
+			return
+		}
+		if !h.qrExists(c, qrID) {
+			return
+		}
+		conditions += " AND s.qr_code_id = ?"
+		args = append(args, id)
+	}
+	for _, bound := range []struct{ param, operator string }{{"from", ">="}, {"to", "<"}} {
+		t, err := parseScheduleTime(c.Query(bound.param), time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + ": " + err.Error()})
+			return
+		}
+		if t != nil {
+			conditions += " AND s.scanned_at " + bound.operator + " ?"
+			args = append(args, formatDBTime(t))
+		}
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="scans.`+format+`"`)
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+
+	var rows rowWriter
+	switch format {
+	case "csv":
+		rows = newCSVRowWriter(c.Writer, scanExportColumns)
+	case "jsonl":
+		rows = &jsonRowWriter{w: c.Writer, columns: scanExportColumns}
+	case "parquet":
+		rows = parquet.NewWriter(c.Writer, scanExportColumns)
+	}
+
+	if err := h.streamScans(c.Writer, rows, conditions, args); err != nil {
+		log.Printf("Error exporting scans: %v", err)
+		return
+	}
+	if err := rows.Close(); err != nil {
+		log.Printf("Error exporting scans: %v", err)
+	}
+}
+
+// streamScans writes the scans matching conditions to rows, a batch at a
+// time, flushing the response after each batch
+func (h *Handler) streamScans(w http.Flusher, rows rowWriter, conditions string, args []interface{}) error {
+	retentionDays, retentionMode := jobs.RetentionPolicy()
+	ipMode := utils.IPAnonymizationMode()
+	query := `SELECT s.id, s.qr_code_id, q.code, s.event_type, s.scanned_at, s.ip_address, s.user_agent,
+			  s.country, s.city, s.browser, s.device_type, s.os, s.referrer, s.rule_id, s.variant_id,
+			  COALESCE(q.retention_days, ?)
+			  FROM qr_scans s JOIN qr_codes q ON q.id = s.qr_code_id
+			  WHERE s.id > ? AND ` + conditions + `
+			  ORDER BY s.id LIMIT ?`
+
+	var lastID int64
+	for {
+		batch, err := h.db.Query(query, append(append([]interface{}{retentionDays, lastID}, args...), scanExportBatch)...)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for batch.Next() {
+			var id, qrID int64
+			var code, eventType string
+			var scannedAt time.Time
+			var ipAddress, userAgent, country, city, browser, deviceType, osName, referrer sql.NullString
+			var ruleID, variantID sql.NullInt64
+			var keepDays int
+			err := batch.Scan(&id, &qrID, &code, &eventType, &scannedAt, &ipAddress, &userAgent,
+				&country, &city, &browser, &deviceType, &osName, &referrer, &ruleID, &variantID, &keepDays)
+			if err != nil {
+				batch.Close()
+				return err
+			}
+			count++
+			lastID = id
+
+			if keepDays > 0 && scannedAt.Before(time.Now().AddDate(0, 0, -keepDays)) {
+				if retentionMode != "anonymize" {
+					continue
+				}
+				ipAddress, userAgent, city = sql.NullString{}, sql.NullString{}, sql.NullString{}
+			}
+			if ipAddress.Valid {
+				ipAddress.String = exportIP(ipAddress.String, ipMode)
+			}
+
+			err = rows.Write([]interface{}{id, qrID, code, eventType, scannedAt.UTC(),
+				exportString(ipAddress), exportString(userAgent), exportString(country), exportString(city),
+				exportString(browser), exportString(deviceType), exportString(osName), exportString(referrer),
+				exportInt(ruleID), exportInt(variantID)})
+			if err != nil {
+				batch.Close()
+				return err
+			}
+		}
+		err = batch.Err()
+		batch.Close()
+		if err != nil {
+			return err
+		}
+
+		w.Flush()
+		if count < scanExportBatch {
+			return nil
+		}
+	}
+}
+
+// exportIP anonymizes a stored IP address in the current mode. Addresses
+// that are already hashed aren't IPs anymore and are kept, and truncating
+// a truncated address changes nothing.
+func exportIP(stored, mode string) string {
+	if net.ParseIP(stored) == nil {
+		return stored
+	}
+	return utils.AnonymizeIP(stored, mode)
+}
+
+// exportString returns an export value for a nullable string, nil for
+// NULL or empty strings
+func exportString(value sql.NullString) interface{} {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	return value.String
+}
+
+func exportInt(value sql.NullInt64) interface{} {
+	if !value.Valid {
+		return nil
+	}
+	return value.Int64
+}
+
+// csvRowWriter writes rows as CSV under a header of the column names.
+// Times are written in RFC 3339 and missing values as empty cells.
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func newCSVRowWriter(w io.Writer, columns []parquet.Column) *csvRowWriter {
+	writer := &csvRowWriter{w: csv.NewWriter(w)}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	writer.w.Write(header)
+	return writer
+}
+
+func (r *csvRowWriter) Write(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case string:
+			record[i] = v
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case time.Time:
+			record[i] = v.Format(time.RFC3339)
+		}
+	}
+	return r.w.Write(record)
+}
+
+func (r *csvRowWriter) Close() error {
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// jsonRowWriter writes rows as JSON objects, one per line, with the keys
+// in column order and missing values as null
+type jsonRowWriter struct {
+	w       io.Writer
+	columns []parquet.Column
+	line    bytes.Buffer
+}
+
+func (r *jsonRowWriter) Write(row []interface{}) error {
+	r.line.Reset()
+	r.line.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			r.line.WriteByte(',')
+		}
+		key, _ := json.Marshal(r.columns[i].Name)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		r.line.Write(key)
+		r.line.WriteByte(':')
+		r.line.Write(encoded)
+	}
+	r.line.WriteString("}\n")
+	_, err := r.w.Write(r.line.Bytes())
+	return err
+}
+
+func (r *jsonRowWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/GridexX/qr-tracker/internal/utils"
+)
+
+// Event types of a scan: a redirect, a view of a dynamic vCard's contact
+// page or a download of its vCard, or an attempt to use a code that is
+// paused, quarantined, archived, expired or used up
+const (
+	eventRedirect      = "redirect"
+	eventPageView      = "page_view"
+	eventVCardDownload = "vcard_download"
+	eventPaused        = "paused"
+	eventQuarantined   = "quarantined"
+	eventArchived      = "archived"
+	eventExpired       = "expired"
+	eventLimitReached  = "limit_reached"
+)
+
+// scanInfo describes the client behind a scan and how it was served
+type scanInfo struct {
+	ClientIP   string
+	UserAgent  string
+	Browser    string
+	DeviceType string
+	OS         string
+	Languages  []string
+	Country    string
+	City       string
+	// Referrer is the host of the page linking to the code, if any
+	Referrer string
+
+	// StoredIP is the client IP as stored, after anonymization
+	StoredIP    string
+	VisitorHash string
+
+	// RuleID is the redirect rule that picked the target URL, if any
+	RuleID sql.NullInt64
+	// VariantID is the split-test variant the client was sent to, if any
+	VariantID sql.NullInt64
+	EventType string
+	// Bot is set when the user agent belongs to a crawler, link previewer
+	// or HTTP library
+	Bot bool
+
+	// Private is set when the client sent Do-Not-Track or Global Privacy
+	// Control. The client is then not geolocated, the other details above
+	// are only used to pick the target URL, and the scan is counted without
+	// them.
+	Private bool
+}
+
+// inspectScan gathers what is known about the client scanning a code
+func (h *Handler) inspectScan(r *http.Request) scanInfo {
+	scan := scanInfo{EventType: eventRedirect}
+	scan.Private = utils.PrivacySignalsHonored() && utils.HasPrivacySignal(r)
+
+	// Get client information
+	scan.UserAgent = r.Header.Get("User-Agent")
+	scan.Browser, scan.DeviceType = utils.ParseUserAgent(scan.UserAgent)
+	scan.OS = utils.ParseOS(scan.UserAgent)
+	scan.Languages = utils.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	scan.Bot = utils.IsBot(scan.UserAgent)
+	scan.ClientIP = utils.GetClientIP(r)
+
+	// Private scans aren't geolocated: that would send their IP to the
+	// geolocation API
+	if scan.Private {
+		return scan
+	}
+	scan.Country, scan.City, _ = utils.GetGeolocation(scan.ClientIP)
+	scan.Referrer = utils.ReferrerHost(r.Referer())
+
+	// Fingerprint the visitor for unique scan counts
+	if salt, err := h.visitorSalt(time.Now()); err != nil {
+		log.Printf("Error loading visitor salt: %v", err)
+	} else {
+		scan.VisitorHash = utils.VisitorHash(salt, scan.ClientIP, scan.UserAgent)
+	}
+
+	// Anonymize the IP before it is stored or forwarded, if configured
+	scan.StoredIP = utils.AnonymizeIP(scan.ClientIP, utils.IPAnonymizationMode())
+
+	return scan
+}
+
+// recordScan stores a scan of the given QR code and returns its ID, or 0
+// if it could not be stored. The scan and its rollup counts are written
+// together. Failing to record a scan is logged but never fails the
+// redirect.
+func (h *Handler) recordScan(qrID int, scan scanInfo) int64 {
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error recording scan: %v", err)
+		return 0
+	}
+	defer tx.Rollback()
+
+	var result sql.Result
+	if scan.Private {
+		result, err = tx.Exec("INSERT INTO qr_scans (qr_code_id, rule_id, variant_id, event_type, is_bot) VALUES (?, ?, ?, ?, ?)",
+			qrID, scan.RuleID, scan.VariantID, scan.EventType, scan.Bot)
+	} else {
+		scanQuery := `INSERT INTO qr_scans (qr_code_id, ip_address, user_agent, country, city, browser, device_type, os,
+					  visitor_hash, rule_id, variant_id, event_type, is_bot, referrer)
+					  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err = tx.Exec(scanQuery, qrID, scan.StoredIP, scan.UserAgent, scan.Country, scan.City,
+			scan.Browser, scan.DeviceType, scan.OS, nullString(scan.VisitorHash), scan.RuleID, scan.VariantID, scan.EventType, scan.Bot, nullString(scan.Referrer))
+	}
+	if err != nil {
+		log.Printf("Error recording scan: %v", err)
+		return 0
+	}
+
+	scanID, _ := result.LastInsertId()
+	if err := rollups.Record(tx, scanID); err != nil {
+		log.Printf("Error updating scan rollups: %v", err)
+		return 0
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error recording scan: %v", err)
+		return 0
+	}
+	return scanID
+}
+
+// qrScanColumns are read by scanQRScan, in order
+const qrScanColumns = `id, qr_code_id, ip_address, user_agent, country, city,
+	browser, device_type, os, referrer, rule_id, variant_id, is_bot, event_type, scanned_at`
+
+// scanQRScan reads a row of qrScanColumns, leaving empty the fields that
+// are NULL
+func scanQRScan(row rowScanner, scan *models.QRScan) error {
+	var ipAddress, userAgent, country, city, browser, deviceType, osName, referrer sql.NullString
+	var ruleID, variantID sql.NullInt64
+	err := row.Scan(&scan.ID, &scan.QRCodeID, &ipAddress, &userAgent, &country, &city,
+		&browser, &deviceType, &osName, &referrer, &ruleID, &variantID, &scan.IsBot, &scan.EventType, &scan.ScannedAt)
+	if err != nil {
+		return err
+	}
+
+	scan.IPAddress = ipAddress.String
+	scan.UserAgent = userAgent.String
+	scan.Country = country.String
+	scan.City = city.String
+	scan.Browser = browser.String
+	scan.DeviceType = deviceType.String
+	scan.OS = osName.String
+	scan.Referrer = referrer.String
+	if ruleID.Valid {
+		matched := int(ruleID.Int64)
+		scan.RuleID = &matched
+	}
+	if variantID.Valid {
+		variant := int(variantID.Int64)
+		scan.VariantID = &variant
+	}
+	return nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
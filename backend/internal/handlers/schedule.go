@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// dbTimeFormat is how timestamps are written, matching CURRENT_TIMESTAMP
+const dbTimeFormat = "2006-01-02 15:04:05"
+
+// localTimeFormats are accepted for times without a UTC offset, which are
+// read in the QR code's timezone
+var localTimeFormats = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseScheduleTime parses an RFC 3339 time, or a local time in loc. An
+// empty value means no bound and returns nil.
+func parseScheduleTime(value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	for _, layout := range localTimeFormats {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time %q, use RFC 3339 or YYYY-MM-DDTHH:MM", value)
+}
+
+// loadLocation returns the location of an IANA timezone name, UTC if empty
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+func formatDBTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(dbTimeFormat), Valid: true}
+}
+
+func (h *Handler) GetSchedule(c *gin.Context) {
+	id := c.Param("id")
+
+	if !h.qrExists(c, id) {
+		return
+	}
+
+	entries, err := h.loadSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// SetSchedule replaces the scheduled target URLs of a QR code. Times
+// without a UTC offset are read in the QR code's timezone.
+func (h *Handler) SetSchedule(c *gin.Context) {
+	id := c.Param("id")
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, entry := range req.Entries {
+		if err := h.checkTargets(entry.TargetURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var timezone string
+	err := h.db.QueryRow("SELECT COALESCE(timezone, '') FROM qr_codes WHERE id = ? AND deleted_at IS NULL", id).Scan(&timezone)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch QR code"})
+		return
+	}
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	type window struct{ start, end *time.Time }
+	windows := make([]window, len(req.Entries))
+	for i, entry := range req.Entries {
+		start, err := parseScheduleTime(entry.StartsAt, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("entry %d: starts_at: %v", i, err)})
+			return
+		}
+		end, err := parseScheduleTime(entry.EndsAt, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("entry %d: ends_at: %v", i, err)})
+			return
+		}
+		if start != nil && end != nil && !end.After(*start) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("entry %d: ends_at must be after starts_at", i)})
+			return
+		}
+		windows[i] = window{start, end}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update schedule"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM qr_schedules WHERE qr_code_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update schedule"})
+		return
+	}
+	for i, entry := range req.Entries {
+		_, err := tx.Exec(`INSERT INTO qr_schedules (qr_code_id, starts_at, ends_at, target_url) VALUES (?, ?, ?, ?)`,
+			id, formatDBTime(windows[i].start), formatDBTime(windows[i].end), entry.TargetURL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update schedule"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update schedule"})
+		return
+	}
+
+	entries, err := h.loadSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func (h *Handler) loadSchedule(qrID interface{}) ([]models.ScheduleEntry, error) {
+	rows, err := h.db.Query(`SELECT id, starts_at, ends_at, target_url FROM qr_schedules
+							 WHERE qr_code_id = ? ORDER BY starts_at IS NOT NULL, starts_at, id`, qrID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.ScheduleEntry{}
+	for rows.Next() {
+		var entry models.ScheduleEntry
+		var startsAt, endsAt sql.NullTime
+		if err := rows.Scan(&entry.ID, &startsAt, &endsAt, &entry.TargetURL); err != nil {
+			return nil, err
+		}
+		if startsAt.Valid {
+			entry.StartsAt = &startsAt.Time
+		}
+		if endsAt.Valid {
+			entry.EndsAt = &endsAt.Time
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// scheduledTarget returns the target URL of the schedule entry active at
+// now, or "" if none is. When windows overlap the one starting last wins.
+func (h *Handler) scheduledTarget(qrID int, now time.Time) (string, error) {
+	entries, err := h.loadSchedule(qrID)
+	if err != nil {
+		return "", err
+	}
+
+	target := ""
+	for _, entry := range entries {
+		if entry.StartsAt != nil && now.Before(*entry.StartsAt) {
+			continue
+		}
+		if entry.EndsAt != nil && !now.Before(*entry.EndsAt) {
+			continue
+		}
+		target = entry.TargetURL
+	}
+	return target, nil
+}
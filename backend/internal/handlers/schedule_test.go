@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/safety"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	paris, err := loadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := loadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value string
+		loc   *time.Location
+		want  string
+	}{
+		{"UTC offset ignores the timezone", "2026-05-01T18:00:00+02:00", newYork, "2026-05-01 16:00:00"},
+		{"UTC by default", "2026-05-01T18:00", time.UTC, "2026-05-01 18:00:00"},
+		{"winter time", "2026-03-28T12:00", paris, "2026-03-28 11:00:00"},
+		{"summer time", "2026-03-29T12:00", paris, "2026-03-29 10:00:00"},
+		{"skipped by spring forward", "2026-03-29T02:30", paris, "2026-03-29 01:30:00"},
+		{"repeated by fall back", "2026-10-25T02:30", paris, "2026-10-25 01:30:00"},
+		{"before fall back", "2026-10-25T01:59:59", paris, "2026-10-24 23:59:59"},
+		{"date only at local midnight", "2026-11-01", newYork, "2026-11-01 04:00:00"},
+		{"after the US change", "2026-11-01 12:00", newYork, "2026-11-01 17:00:00"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseScheduleTime(tc.value, tc.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formatDBTime(got).String != tc.want {
+				t.Errorf("%s = %s UTC, want %s", tc.value, formatDBTime(got).String, tc.want)
+			}
+		})
+	}
+
+	if got, err := parseScheduleTime("", paris); got != nil || err != nil {
+		t.Errorf("empty value = %v, %v", got, err)
+	}
+	if _, err := parseScheduleTime("01/05/2026", paris); err == nil {
+		t.Error("invalid format accepted")
+	}
+	if _, err := loadLocation("Europe/Atlantis"); err == nil {
+		t.Error("unknown timezone accepted")
+	}
+}
+
+func TestScheduleAcrossDST(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	h := &Handler{db: db, safety: &safety.Policy{Schemes: []string{"https"}}}
+	qr := insertTestQR(t, db, "night", accessOpen, nil)
+	db.Exec("UPDATE qr_codes SET timezone = 'Europe/Paris' WHERE id = ?", qr.ID)
+
+	setSchedule := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(qr.ID)}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.SetSchedule(c)
+		return w
+	}
+
+	// The night of the fall back change lasts 25 hours from 20:00 to 20:00
+	w := setSchedule(`{"entries": [
+		{"starts_at": "2026-10-24T20:00", "ends_at": "2026-10-25T20:00", "target_url": "https://example.com/night"},
+		{"starts_at": "2026-10-25T02:00", "ends_at": "2026-10-25T03:00", "target_url": "https://example.com/extra-hour"}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		at   string
+		want string
+	}{
+		{"2026-10-24T17:59:59Z", ""},
+		{"2026-10-24T18:00:00Z", "https://example.com/night"},
+		{"2026-10-25T00:30:00Z", "https://example.com/night"},
+		{"2026-10-25T01:00:00Z", "https://example.com/extra-hour"},
+		{"2026-10-25T01:59:59Z", "https://example.com/extra-hour"},
+		{"2026-10-25T02:00:00Z", "https://example.com/night"},
+		{"2026-10-25T18:59:59Z", "https://example.com/night"},
+		{"2026-10-25T19:00:00Z", ""},
+	} {
+		now, _ := time.Parse(time.RFC3339, tc.at)
+		got, err := h.scheduledTarget(qr.ID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("at %s: %q, want %q", tc.at, got, tc.want)
+		}
+	}
+
+	// Windows are checked in the code's timezone too
+	for _, body := range []string{
+		`{"entries": [{"starts_at": "2026-10-25T02:30", "ends_at": "2026-10-25T02:30:00+02:00", "target_url": "https://example.com/"}]}`,
+		`{"entries": [{"starts_at": "2026-10-25", "ends_at": "yesterday", "target_url": "https://example.com/"}]}`,
+		`{"entries": [{"starts_at": "2026-10-25", "target_url": "ftp://example.com/"}]}`,
+	} {
+		if w := setSchedule(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/gin-gonic/gin"
+)
+
+// codeScope returns the WHERE condition and arguments selecting QR codes
+// (alias q) that carry every one of tags and sit in folder or below it.
+// A folder of "none" selects codes outside any folder; an empty one
+// doesn't filter.
+func codeScope(tags []string, folder, campaign string) (string, []interface{}, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	for _, tag := range tags {
+		conditions = append(conditions, `q.id IN (SELECT qt.qr_code_id FROM qr_code_tags qt
+			JOIN tags t ON t.id = qt.tag_id WHERE t.name = ?)`)
+		args = append(args, strings.TrimSpace(tag))
+	}
+
+	switch folder {
+	case "":
+	case "none":
+		conditions = append(conditions, "q.folder_id IS NULL")
+	default:
+		id, err := strconv.Atoi(folder)
+		if err != nil {
+			return "", nil, fmt.Errorf("folder must be a folder ID or none")
+		}
+		conditions = append(conditions, "q.folder_id IN ("+folderTree+")")
+		args = append(args, id)
+	}
+
+	if campaign != "" {
+		conditions = append(conditions, "q.utm_campaign = ?")
+		args = append(args, campaign)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// scopeFromQuery reads the code scope from the tag, folder and campaign
+// query parameters. tag may be repeated.
+func (h *Handler) scopeFromQuery(c *gin.Context) (string, []interface{}, error) {
+	return codeScope(c.QueryArray("tag"), c.Query("folder"), c.Query("campaign"))
+}
+
+// scopedScans selects the scans of live QR codes within a code scope
+func scopedScans(scope string) string {
+	return "qr_code_id IN (SELECT q.id FROM qr_codes q WHERE q.deleted_at IS NULL AND " + scope + ")"
+}
+
+// scanCounts selects the daily counts of a rollup dimension for the live
+// QR codes within a code scope, see rollups.Counts
+func scanCounts(dimension, scope string) string {
+	return rollups.Counts(dimension) + " c WHERE " + scopedScans(scope)
+}
+
+// scanTotals joins the total and unique scans of each QR code (alias q)
+// as c.scans and c.unique_scans, NULL for codes never scanned
+var scanTotals = `LEFT JOIN (SELECT qr_code_id, SUM(scans) AS scans, SUM(unique_scans) AS unique_scans
+	FROM ` + rollups.Counts(rollups.Total) + ` GROUP BY qr_code_id) c ON c.qr_code_id = q.id`
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Statuses of a QR code. Paused, quarantined and archived codes stop
+// redirecting but keep their scan history. Codes are quarantined when a
+// target URL fails the URL policy.
+const (
+	statusActive      = "active"
+	statusPaused      = "paused"
+	statusQuarantined = "quarantined"
+	statusArchived    = "archived"
+)
+
+// defaultPausedPage is served for scans of paused codes
+const defaultPausedPage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Temporarily unavailable</title>
+    <style>
+        body { font-family: sans-serif; max-width: 30rem; margin: 4rem auto; padding: 0 1rem; text-align: center; }
+    </style>
+</head>
+<body>
+    <h1>Temporarily unavailable</h1>
+    <p>This QR code is paused. Please try again later.</p>
+</body>
+</html>`
+
+// pausedPageData is passed to the paused page template, including custom
+// templates loaded from PAUSED_TEMPLATE_PATH
+type pausedPageData struct {
+	Code  string
+	Title string
+}
+
+// loadPausedPage parses the template named by PAUSED_TEMPLATE_PATH,
+// falling back to the built-in page if it is unset or invalid
+func loadPausedPage() *template.Template {
+	if path := os.Getenv("PAUSED_TEMPLATE_PATH"); path != "" {
+		tmpl, err := template.ParseFiles(path)
+		if err == nil {
+			return tmpl
+		}
+		log.Printf("Could not load paused template %s, using default: %v", path, err)
+	}
+	return template.Must(template.New("paused").Parse(defaultPausedPage))
+}
+
+// renderPaused answers scans of a paused code with PAUSED_REDIRECT_URL if
+// set, or the paused page
+func (h *Handler) renderPaused(c *gin.Context, qr models.QRCode) {
+	if pausedURL := os.Getenv("PAUSED_REDIRECT_URL"); pausedURL != "" {
+		c.Redirect(http.StatusFound, pausedURL)
+		return
+	}
+
+	var page bytes.Buffer
+	if err := h.pausedPage.Execute(&page, pausedPageData{Code: qr.Code, Title: qr.Title}); err != nil {
+		log.Printf("Error rendering paused page: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "QR code is paused"})
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; img-src https: data:; style-src 'unsafe-inline'; base-uri 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusServiceUnavailable, "text/html; charset=utf-8", page.Bytes())
+}
+
+// UpdateQRStatus activates, pauses or archives a QR code
+func (h *Handler) UpdateQRStatus(c *gin.Context) {
+	id := c.Param("id")
+	var req models.StatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.db.Exec(`UPDATE qr_codes SET status = ?, quarantine_reason = NULL, updated_at = CURRENT_TIMESTAMP
+							  WHERE id = ? AND deleted_at IS NULL`, req.Status, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update QR code status"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "QR code status updated successfully", "status": req.Status})
+}
+
+// quarantine stops a QR code whose target failed the URL policy
+func (h *Handler) quarantine(qrID int, reason string) {
+	_, err := h.db.Exec(`UPDATE qr_codes SET status = ?, quarantine_reason = ?, updated_at = CURRENT_TIMESTAMP
+						 WHERE id = ?`, statusQuarantined, reason, qrID)
+	if err != nil {
+		log.Printf("Error quarantining QR code %d: %v", qrID, err)
+	}
+}
+
+// statusFilter returns the WHERE condition and arguments selecting QR codes
+// by the status query parameter. Archived codes are left out unless asked
+// for; "all" selects every status.
+func statusFilter(status string) (string, []interface{}, bool) {
+	switch status {
+	case "":
+		return "q.status != ?", []interface{}{statusArchived}, true
+	case "all":
+		return "1 = 1", nil, true
+	case statusActive, statusPaused, statusQuarantined, statusArchived:
+		return "q.status = ?", []interface{}{status}, true
+	default:
+		return "", nil, false
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxTags       = 50
+	maxTagLength  = 64
+	tagsSeparator = "\x1f"
+)
+
+// normalizeTags trims tags and drops duplicates, which are compared
+// case-insensitively like the tags table does
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("a QR code can have at most %d tags", maxTags)
+	}
+
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" {
+			return nil, fmt.Errorf("tags must not be empty")
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		if strings.IndexFunc(tag, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("tag %q must not contain control characters", tag)
+		}
+		if key := strings.ToLower(tag); !seen[key] {
+			seen[key] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// setQRTags replaces the tags of a QR code, creating tags used for the
+// first time
+func setQRTags(db execer, qrID int, tags []string) error {
+	if _, err := db.Exec("DELETE FROM qr_code_tags WHERE qr_code_id = ?", qrID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := db.Exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING", tag); err != nil {
+			return err
+		}
+		_, err := db.Exec("INSERT OR IGNORE INTO qr_code_tags (qr_code_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", qrID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTags lists the tags in use with how many QR codes carry each
+func (h *Handler) ListTags(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT t.id, t.name, COUNT(q.id) FROM tags t
+							 LEFT JOIN qr_code_tags qt ON qt.tag_id = t.id
+							 LEFT JOIN qr_codes q ON q.id = qt.qr_code_id AND q.deleted_at IS NULL
+							 GROUP BY t.id
+							 ORDER BY t.name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch tags"})
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.QRCodes); err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// DeleteTag removes a tag from every QR code carrying it
+func (h *Handler) DeleteTag(c *gin.Context) {
+	id := c.Param("id")
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete tag"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM qr_code_tags WHERE tag_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete tag"})
+		return
+	}
+	result, err := tx.Exec("DELETE FROM tags WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete tag"})
+		return
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// GetTagAnalytics totals the scans of the QR codes carrying each tag. A
+// code with several tags counts towards each of them.
+func (h *Handler) GetTagAnalytics(c *gin.Context) {
+	scope, args, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `
+		SELECT t.name, COUNT(DISTINCT q.id) as qr_codes,
+			   COALESCE(SUM(c.scans), 0) as total_scans, COALESCE(SUM(c.unique_scans), 0) as unique_scans
+		FROM tags t
+		JOIN qr_code_tags qt ON qt.tag_id = t.id
+		JOIN qr_codes q ON q.id = qt.qr_code_id
+		` + scanTotals + `
+		WHERE q.deleted_at IS NULL AND ` + scope + `
+		GROUP BY t.id
+		ORDER BY total_scans DESC, t.name
+	`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch tag analytics"})
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.TagAnalytics{}
+	for rows.Next() {
+		var tag models.TagAnalytics
+		if err := rows.Scan(&tag.Tag, &tag.QRCodes, &tag.TotalScans, &tag.UniqueScans); err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
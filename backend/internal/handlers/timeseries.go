@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTimeSeriesDays = 30
+	maxTimeSeriesDays     = 3660
+	maxTimeSeriesBuckets  = 1000
+	maxTimeSeriesCodes    = 20
+)
+
+// bucketLabels format the start of a bucket, per granularity. Hours keep
+// their UTC offset so the repeated hour at the end of daylight saving time
+// stays distinct.
+var bucketLabels = map[string]string{
+	"hour":  "2006-01-02T15:04Z07:00",
+	"day":   "2006-01-02",
+	"week":  "2006-01-02",
+	"month": "2006-01",
+}
+
+// bucket is a time span of a series, from start up to but not including
+// end
+type bucket struct {
+	start, end time.Time
+}
+
+// bucketStart returns the start of the bucket holding t, in t's location.
+// Weeks start on Monday.
+func bucketStart(t time.Time, granularity string) time.Time {
+	year, month, day := t.Date()
+	switch granularity {
+	case "hour":
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case "week":
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextBucket returns the start of the bucket after the one starting at start
+func nextBucket(start time.Time, granularity string) time.Time {
+	year, month, day := start.Date()
+	switch granularity {
+	case "hour":
+		return start.Add(time.Hour)
+	case "week":
+		return time.Date(year, month, day+7, 0, 0, 0, 0, start.Location())
+	case "month":
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// timeBuckets splits from to to into buckets, the first starting at the
+// bucket holding from and the last cut off at to
+func timeBuckets(from, to time.Time, granularity string) ([]bucket, error) {
+	var buckets []bucket
+	for start := bucketStart(from, granularity); start.Before(to); {
+		if len(buckets) == maxTimeSeriesBuckets {
+			return nil, fmt.Errorf("the range holds more than %d buckets, use a coarser granularity", maxTimeSeriesBuckets)
+		}
+		end := nextBucket(start, granularity)
+		if end.After(to) {
+			end = to
+		}
+		buckets = append(buckets, bucket{start, end})
+		start = end
+	}
+	return buckets, nil
+}
+
+// previousBuckets returns as many buckets as given right before them. The
+// last is cut off as far into its span as the last given bucket is.
+func previousBuckets(buckets []bucket, granularity string) []bucket {
+	previous := make([]bucket, len(buckets))
+	end := buckets[0].start
+	for i := len(buckets) - 1; i >= 0; i-- {
+		start := bucketStart(end.Add(-time.Nanosecond), granularity)
+		previous[i] = bucket{start, end}
+		end = start
+	}
+	last := len(buckets) - 1
+	if cut := previous[last].start.Add(buckets[last].end.Sub(buckets[last].start)); cut.Before(previous[last].end) {
+		previous[last].end = cut
+	}
+	return previous
+}
+
+// GetTimeSeriesData counts scans per hour, day, week or month between from
+// and to, in the tz timezone. Buckets without scans are included. Each
+// qr_id gets its own series; without one, a single series covers every
+// code in scope. With compare=true each series also holds the period just
+// before.
+func (h *Handler) GetTimeSeriesData(c *gin.Context) {
+	loc, err := loadLocation(c.Query("tz"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	granularity := c.DefaultQuery("granularity", "day")
+	if _, ok := bucketLabels[granularity]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be hour, day, week or month"})
+		return
+	}
+
+	now := time.Now()
+	to := now.In(loc)
+	if value := c.Query("to"); value != "" {
+		t, err := parseScheduleTime(value, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to: " + err.Error()})
+			return
+		}
+		to = t.In(loc)
+	}
+	var from time.Time
+	if value := c.Query("from"); value != "" {
+		t, err := parseScheduleTime(value, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from: " + err.Error()})
+			return
+		}
+		from = t.In(loc)
+	} else {
+		// days counts back from to, to included
+		days := defaultTimeSeriesDays
+		if value := c.Query("days"); value != "" {
+			days, err = strconv.Atoi(value)
+			if err != nil || days < 1 || days > maxTimeSeriesDays {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between 1 and %d", maxTimeSeriesDays)})
+				return
+			}
+		}
+		start := bucketStart(to, "day")
+		from = time.Date(start.Year(), start.Month(), start.Day()-days+1, 0, 0, 0, 0, loc)
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	buckets, err := timeBuckets(from, to, granularity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, args, err := h.scopeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conditions := scopedScans(scope)
+
+	qrIDs := c.QueryArray("qr_id")
+	if len(qrIDs) > maxTimeSeriesCodes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d qr_id values are allowed", maxTimeSeriesCodes)})
+		return
+	}
+	var codes []int
+	for _, value := range qrIDs {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "qr_id must be a QR code ID"})
+			return
+		}
+		if !h.qrExists(c, value) {
+			return
+		}
+		codes = append(codes, id)
+	}
+	if len(codes) > 0 {
+		conditions += " AND qr_code_id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(codes)), ", ") + ")"
+		for _, id := range codes {
+			args = append(args, id)
+		}
+	}
+
+	series, err := h.timeSeries(buckets, granularity, codes, conditions, args, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch time series data"})
+		return
+	}
+	if c.Query("compare") == "true" {
+		previous, err := h.timeSeries(previousBuckets(buckets, granularity), granularity, codes, conditions, args, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch time series data"})
+			return
+		}
+		for i := range series {
+			series[i].Previous = &previous[i]
+			if previous[i].TotalScans > 0 {
+				change := percentage(series[i].TotalScans-previous[i].TotalScans, previous[i].TotalScans)
+				series[i].Change = &change
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, models.TimeSeriesResponse{
+		From:        buckets[0].start,
+		To:          to,
+		Granularity: granularity,
+		Timezone:    loc.String(),
+		Series:      series,
+	})
+}
+
+// rollupSlots are the rollups a time series can be counted from: daily
+// totals, or the hour dimension for buckets that split UTC days. slot is
+// the start of a count's day or hour, compared with bucket bounds in format.
+var rollupSlots = []struct {
+	span, dimension, slot, format string
+}{
+	{"day", rollups.Total, "c.day", "2006-01-02"},
+	{"hour", "hour", "c.day || ' ' || c.value || ':00:00'", dbTimeFormat},
+}
+
+// alignedTo reports whether each bucket starts at the start of a UTC day
+// or hour, per span, and ends at one or not before now
+func alignedTo(buckets []bucket, span string, now time.Time) bool {
+	for _, b := range buckets {
+		if !b.start.Equal(bucketStart(b.start.UTC(), span)) {
+			return false
+		}
+		if !b.end.Equal(bucketStart(b.end.UTC(), span)) && b.end.Before(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// timeSeries counts the scans matching conditions in each bucket, in one
+// series per code of codes, or a single series if there are none. Buckets
+// of whole UTC days or hours are counted from the rollups; others from the
+// scans, with unique scans counted per code and day as the rollups do.
+func (h *Handler) timeSeries(buckets []bucket, granularity string, codes []int, conditions string, args []interface{}, now time.Time) ([]models.TimeSeries, error) {
+	counted := `COUNT(s.id), SUM(` + rollups.FirstVisit + `)
+			  FROM buckets b JOIN qr_scans s ON s.scanned_at >= b.start AND s.scanned_at < b.finish AND s.` + rollups.Counted
+	values := make([]string, len(buckets))
+	bucketArgs := make([]interface{}, 0, 3*len(buckets))
+	for i, b := range buckets {
+		values[i] = "(?, ?, ?)"
+		// Scan times are stored to the second, so an end not before now
+		// is rounded up to take in scans from the current second
+		end := b.end
+		if !end.Before(now) {
+			end = end.Truncate(time.Second).Add(time.Second)
+		}
+		bucketArgs = append(bucketArgs, i, formatDBTime(&b.start), formatDBTime(&end))
+	}
+	for _, slot := range rollupSlots {
+		if !alignedTo(buckets, slot.span, now) {
+			continue
+		}
+		counted = `SUM(c.scans), SUM(c.unique_scans)
+			  FROM buckets b JOIN ` + rollups.Counts(slot.dimension) + ` c ON ` + slot.slot + ` >= b.start AND ` + slot.slot + ` < b.finish`
+		bucketArgs = bucketArgs[:0]
+		for i, b := range buckets {
+			end := bucketStart(b.end.UTC(), slot.span)
+			if !end.Equal(b.end) {
+				end = nextBucket(end, slot.span)
+			}
+			bucketArgs = append(bucketArgs, i, b.start.UTC().Format(slot.format), end.Format(slot.format))
+		}
+		break
+	}
+
+	code, groupBy := "0", "b.idx"
+	if len(codes) > 0 {
+		code, groupBy = "qr_code_id", "b.idx, qr_code_id"
+	}
+	query := `WITH buckets(idx, start, finish) AS (VALUES ` + strings.Join(values, ", ") + `)
+			  SELECT b.idx, ` + code + `, ` + counted + `
+			  WHERE ` + conditions + `
+			  GROUP BY ` + groupBy
+
+	rows, err := h.db.Query(query, append(bucketArgs, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[[2]int]models.TimeSeriesData{}
+	for rows.Next() {
+		var idx, qrID int
+		var point models.TimeSeriesData
+		if err := rows.Scan(&idx, &qrID, &point.Scans, &point.UniqueScans); err != nil {
+			return nil, err
+		}
+		counts[[2]int{qrID, idx}] = point
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	series := make([]models.TimeSeries, len(codes))
+	for i, qrID := range codes {
+		if qrID != 0 {
+			id := qrID
+			series[i].QRCodeID = &id
+		}
+		series[i].Points = make([]models.TimeSeriesData, len(buckets))
+		for idx, b := range buckets {
+			point := counts[[2]int{qrID, idx}]
+			point.Date = b.start.Format(bucketLabels[granularity])
+			series[i].Points[idx] = point
+			series[i].TotalScans += point.Scans
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/rollups"
+)
+
+func TestTimeSeriesCountsAgree(t *testing.T) {
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	a := insertTestQR(t, db, "series-a", accessOpen, nil)
+	b := insertTestQR(t, db, "series-b", accessOpen, nil)
+
+	now := time.Now()
+	today := bucketStart(now.UTC(), "day")
+	day0 := today.AddDate(0, 0, -3)
+	for _, scan := range []struct {
+		qrID      int
+		at        time.Time
+		visitor   interface{}
+		eventType string
+	}{
+		{a.ID, day0.Add(10 * time.Hour), "v1", eventRedirect},
+		{a.ID, day0.Add(11 * time.Hour), "v1", eventRedirect},
+		{a.ID, day0.Add(26 * time.Hour), "v1", eventRedirect},
+		{b.ID, day0.Add(10 * time.Hour), "v1", eventRedirect},
+		{a.ID, day0.Add(12 * time.Hour), "v2", eventPageView},
+		{a.ID, day0.Add(13 * time.Hour), "v2", eventVCardDownload},
+		{a.ID, day0.Add(30 * time.Hour), nil, eventRedirect},
+		{a.ID, today, "v1", eventRedirect},
+	} {
+		_, err := db.Exec("INSERT INTO qr_scans (qr_code_id, visitor_hash, event_type, scanned_at) VALUES (?, ?, ?, ?)",
+			scan.qrID, scan.visitor, scan.eventType, scan.at.Format(dbTimeFormat))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rollups.Rebuild(db, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		loc        *time.Location
+		daily      bool
+		hourly     bool
+		wantScans  int
+		wantUnique int
+	}{
+		{"UTC days from daily rollups", time.UTC, true, true, 7, 5},
+		{"whole hour offset from hourly rollups", time.FixedZone("+02", 2*3600), false, true, 7, 5},
+		{"half hour offset from scans", time.FixedZone("+0530", 5*3600+1800), false, false, 7, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			to := now.In(tc.loc)
+			from := bucketStart(day0.In(tc.loc), "day").AddDate(0, 0, -1)
+			buckets, err := timeBuckets(from, to, "day")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alignedTo(buckets, "day", now) != tc.daily || alignedTo(buckets, "hour", now) != tc.hourly {
+				t.Fatalf("buckets aligned to days %v, hours %v", alignedTo(buckets, "day", now), alignedTo(buckets, "hour", now))
+			}
+
+			series, err := h.timeSeries(buckets, "day", nil, scopedScans("1 = 1"), nil, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unique := 0
+			for _, point := range series[0].Points {
+				unique += point.UniqueScans
+			}
+			if series[0].TotalScans != tc.wantScans || unique != tc.wantUnique {
+				t.Errorf("%d scans, %d unique, want %d and %d", series[0].TotalScans, unique, tc.wantScans, tc.wantUnique)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash lists deleted QR codes that haven't been purged yet
+func (h *Handler) ListTrash(c *gin.Context) {
+	query := `
+		SELECT ` + qrCodeColumns + `, COALESCE(c.scans, 0) as total_scans,
+			   COALESCE(c.unique_scans, 0) as unique_scans, q.deleted_at
+		FROM qr_codes q
+		` + scanTotals + `
+		WHERE q.deleted_at IS NOT NULL
+		ORDER BY q.deleted_at DESC
+	`
+
+	rows, err := h.db.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch deleted QR codes"})
+		return
+	}
+	defer rows.Close()
+
+	qrCodes := []models.QRCode{}
+	for rows.Next() {
+		var qr models.QRCode
+		var deletedAt sql.NullTime
+		if err := scanQRCode(rows, &qr, &qr.TotalScans, &qr.UniqueScans, &deletedAt); err != nil {
+			continue
+		}
+		if deletedAt.Valid {
+			qr.DeletedAt = &deletedAt.Time
+		}
+		qrCodes = append(qrCodes, qr)
+	}
+
+	c.JSON(http.StatusOK, qrCodes)
+}
+
+// RestoreQR takes a QR code back out of the trash
+func (h *Handler) RestoreQR(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.db.Exec(`UPDATE qr_codes SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+							  WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not restore QR code"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not found in trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "QR code restored successfully"})
+}
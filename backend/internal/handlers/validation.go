@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/payload"
+	"github.com/skip2/go-qrcode"
+)
+
+// maxMetadataSize is the largest metadata object a QR code may carry
+const maxMetadataSize = 16 << 10
+
+// validateQRRequest checks the fields of a create or update request that
+// binding tags can't express
+func (h *Handler) validateQRRequest(req *models.CreateQRRequest) error {
+	if req.PayloadType == "" {
+		req.PayloadType = payload.URL
+	}
+	requested := req.Dynamic != nil && *req.Dynamic
+	if requested && !payload.Dynamic(req.PayloadType, true) {
+		return fmt.Errorf("dynamic is only supported for url and vcard codes")
+	}
+	dynamic := payload.Dynamic(req.PayloadType, requested)
+	req.Dynamic = &dynamic
+	if req.PayloadType == payload.URL {
+		if req.TargetURL == "" {
+			return fmt.Errorf("target_url is required for url codes")
+		}
+		req.Payload = nil
+	} else {
+		content, normalized, err := payload.Normalize(req.PayloadType, req.Payload)
+		if err != nil {
+			return fmt.Errorf("payload: %v", err)
+		}
+		if _, err := qrcode.New(content, qrcode.Medium); err != nil && !dynamic {
+			return fmt.Errorf("payload is too long to fit in a QR code")
+		}
+		req.Payload = normalized
+		req.TargetURL = ""
+	}
+
+	if err := h.checkTargets(req.TargetURL, req.ExpiredURL); err != nil {
+		return err
+	}
+
+	utm := []struct{ name, value string }{
+		{"utm_source", req.Source},
+		{"utm_medium", req.Medium},
+		{"utm_campaign", req.Campaign},
+		{"utm_term", req.Term},
+		{"utm_content", req.Content},
+	}
+	for _, param := range utm {
+		for _, r := range param.value {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("%s must not contain control characters", param.name)
+			}
+		}
+	}
+
+	loc, err := loadLocation(req.Timezone)
+	if err != nil {
+		return err
+	}
+	if _, err := parseScheduleTime(req.ExpiresAt, loc); err != nil {
+		return fmt.Errorf("expires_at: %v", err)
+	}
+
+	if req.Tags != nil {
+		tags, err := normalizeTags(req.Tags)
+		if err != nil {
+			return err
+		}
+		req.Tags = tags
+	}
+	if req.Metadata != nil && string(req.Metadata) != "null" {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(req.Metadata, &fields); err != nil {
+			return fmt.Errorf("metadata must be a JSON object")
+		}
+		if len(req.Metadata) > maxMetadataSize {
+			return fmt.Errorf("metadata must not be larger than %d bytes", maxMetadataSize)
+		}
+	}
+
+	if req.AccessMode == "" {
+		req.AccessMode = accessOpen
+	}
+	if req.AccessMode == accessMaxScans && req.MaxScans == nil {
+		return fmt.Errorf("max_scans is required with the max_scans access mode")
+	}
+	if req.AccessMode != accessMaxScans {
+		req.MaxScans = nil
+	}
+
+	return nil
+}
+
+// checkTargets validates target URLs against the URL policy. Empty URLs
+// are skipped.
+func (h *Handler) checkTargets(targets ...string) error {
+	for _, target := range targets {
+		if target == "" {
+			continue
+		}
+		if err := h.safety.Check(target); err != nil {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+	}
+	return nil
+}
+
+// metadataValue returns the metadata of a request as stored, NULL for
+// none
+func metadataValue(metadata json.RawMessage) sql.NullString {
+	if string(metadata) == "null" {
+		return sql.NullString{}
+	}
+	return nullString(string(metadata))
+}
+
+// metadataField returns the metadata of a request as returned in a QR code
+func metadataField(metadata json.RawMessage) json.RawMessage {
+	if string(metadata) == "null" {
+		return nil
+	}
+	return metadata
+}
+
+// requestExpiry returns the expiry time of a validated request
+func requestExpiry(req *models.CreateQRRequest) *time.Time {
+	loc, err := loadLocation(req.Timezone)
+	if err != nil {
+		return nil
+	}
+	expiresAt, _ := parseScheduleTime(req.ExpiresAt, loc)
+	return expiresAt
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"hash/fnv"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/gin-gonic/gin"
+)
+
+// variantCookieMaxAge keeps a visitor on the same variant for 30 days
+const variantCookieMaxAge = 30 * 24 * 60 * 60
+
+func (h *Handler) GetVariants(c *gin.Context) {
+	id := c.Param("id")
+
+	if !h.qrExists(c, id) {
+		return
+	}
+
+	variants, err := h.loadVariants(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch variants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, variants)
+}
+
+// SetVariants replaces the split-test destinations of a QR code. Variants
+// sent with their id are updated in place so their scan history is kept;
+// variants left out are removed.
+func (h *Handler) SetVariants(c *gin.Context) {
+	id := c.Param("id")
+	var req models.VariantsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, variant := range req.Variants {
+		if err := h.checkTargets(variant.TargetURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !h.qrExists(c, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variants"})
+		return
+	}
+	defer tx.Rollback()
+
+	keep := []interface{}{id}
+	placeholders := ""
+	for _, variant := range req.Variants {
+		if variant.ID != 0 {
+			result, err := tx.Exec(`UPDATE qr_variants SET name = ?, target_url = ?, weight = ?
+									WHERE id = ? AND qr_code_id = ?`,
+				variant.Name, variant.TargetURL, variant.Weight, variant.ID, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variants"})
+				return
+			}
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown variant id " + strconv.Itoa(variant.ID)})
+				return
+			}
+			keep = append(keep, variant.ID)
+		} else {
+			result, err := tx.Exec(`INSERT INTO qr_variants (qr_code_id, name, target_url, weight) VALUES (?, ?, ?, ?)`,
+				id, variant.Name, variant.TargetURL, variant.Weight)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variants"})
+				return
+			}
+			newID, _ := result.LastInsertId()
+			keep = append(keep, newID)
+		}
+		placeholders += ", ?"
+	}
+
+	query := "DELETE FROM qr_variants WHERE qr_code_id = ?"
+	if placeholders != "" {
+		query += " AND id NOT IN (" + placeholders[2:] + ")"
+	}
+	if _, err := tx.Exec(query, keep...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variants"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update variants"})
+		return
+	}
+
+	variants, err := h.loadVariants(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch variants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, variants)
+}
+
+func (h *Handler) loadVariants(qrID interface{}) ([]models.Variant, error) {
+	rows, err := h.db.Query(`SELECT id, name, target_url, weight FROM qr_variants
+							 WHERE qr_code_id = ? ORDER BY id`, qrID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []models.Variant{}
+	for rows.Next() {
+		var variant models.Variant
+		if err := rows.Scan(&variant.ID, &variant.Name, &variant.TargetURL, &variant.Weight); err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+// pickVariant chooses the split-test destination for a scan, or returns
+// nil if the QR code has none. A visitor keeps the variant stored in their
+// cookie; new visitors are assigned by weight, from their visitor hash
+// when there is one so repeat scans on the same day agree.
+func (h *Handler) pickVariant(c *gin.Context, qr models.QRCode, scan scanInfo) (*models.Variant, error) {
+	variants, err := h.loadVariants(qr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	cookieName := "qr_variant_" + qr.Code
+	if value, err := c.Cookie(cookieName); err == nil {
+		for i := range variants {
+			if strconv.Itoa(variants[i].ID) == value && variants[i].Weight > 0 {
+				return &variants[i], nil
+			}
+		}
+	}
+
+	var point int
+	if scan.VisitorHash != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(qr.Code + ":" + scan.VisitorHash))
+		point = int(hash.Sum32() % uint32(total))
+	} else {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(total)))
+		if err != nil {
+			return nil, err
+		}
+		point = int(n.Int64())
+	}
+
+	var chosen *models.Variant
+	for i := range variants {
+		if point < variants[i].Weight {
+			chosen = &variants[i]
+			break
+		}
+		point -= variants[i].Weight
+	}
+
+	// Clients that opted out of tracking aren't given a cookie
+	if !scan.Private {
+		c.SetCookie(cookieName, strconv.Itoa(chosen.ID), variantCookieMaxAge, "/", "", false, true)
+	}
+	return chosen, nil
+}
+
+// variantAnalytics breaks the scans and conversions of a QR code down per
+// variant. Unique scans are counted as in the rollups, once per visitor and
+// day, on the variant of the visitor's first scan that day.
+func (h *Handler) variantAnalytics(qrID interface{}) ([]models.VariantAnalytics, error) {
+	query := `
+		SELECT v.id, v.name, v.target_url, v.weight,
+			   (SELECT COUNT(*) FROM qr_scans s WHERE s.variant_id = v.id AND s.` + rollups.Counted + `) as scans,
+			   (SELECT COALESCE(SUM(` + rollups.FirstVisit + `), 0) FROM qr_scans s WHERE s.variant_id = v.id AND s.` + rollups.Counted + `) as unique_scans,
+			   (SELECT COUNT(*) FROM qr_conversions x WHERE x.variant_id = v.id) as conversions,
+			   (SELECT COUNT(DISTINCT scan_id) FROM qr_conversions x WHERE x.variant_id = v.id) as converted_scans,
+			   (SELECT COALESCE(SUM(value), 0) FROM qr_conversions x WHERE x.variant_id = v.id) as conversion_value
+		FROM qr_variants v
+		WHERE v.qr_code_id = ?
+		ORDER BY v.id
+	`
+	rows, err := h.db.Query(query, qrID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.VariantAnalytics{}
+	for rows.Next() {
+		var variant models.VariantAnalytics
+		var convertedScans int
+		err := rows.Scan(&variant.VariantID, &variant.Name, &variant.TargetURL, &variant.Weight,
+			&variant.Scans, &variant.UniqueScans, &variant.Conversions, &convertedScans, &variant.ConversionValue)
+		if err != nil {
+			return nil, err
+		}
+		variant.ConversionRate = conversionRate(convertedScans, variant.Scans)
+		stats = append(stats, variant)
+	}
+	return stats, rows.Err()
+}
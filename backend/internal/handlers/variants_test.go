@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPickVariant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	qr := insertTestQR(t, db, "split", accessOpen, nil)
+	for _, variant := range []struct {
+		name   string
+		weight int
+	}{{"a", 1}, {"b", 1}, {"paused", 0}} {
+		if _, err := db.Exec("INSERT INTO qr_variants (qr_code_id, name, target_url, weight) VALUES (?, ?, 'https://example.com/', ?)",
+			qr.ID, variant.name, variant.weight); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const a, b, paused = "1", "2", "3"
+
+	pick := func(cookie string, scan scanInfo) (string, string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/r/split", nil)
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: "qr_variant_split", Value: cookie})
+		}
+		variant, err := h.pickVariant(c, qr, scan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set := ""
+		for _, setCookie := range w.Result().Cookies() {
+			set = setCookie.Value
+		}
+		if variant == nil {
+			return "", set
+		}
+		return strconv.Itoa(variant.ID), set
+	}
+
+	for _, tc := range []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"cookie keeps the variant", b, b},
+		{"cookie of the other variant", a, a},
+		// Cookies that can't be honored are replaced by a new assignment
+		{"cookie of a variant with weight 0", paused, ""},
+		{"unknown cookie", "99", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, set := pick(tc.cookie, scanInfo{VisitorHash: "visitor-1"})
+			if tc.want != "" && (got != tc.want || set != "") {
+				t.Errorf("variant %s, cookie set to %q, want %s and no new cookie", got, set, tc.want)
+			}
+			if tc.want == "" && (got == "" || got == paused || set != got) {
+				t.Errorf("variant %s, cookie set to %q, want a new assignment", got, set)
+			}
+		})
+	}
+
+	// New visitors stay on the variant their visitor hash picks, and get a
+	// cookie for it unless they opted out of tracking
+	first, set := pick("", scanInfo{VisitorHash: "visitor-2"})
+	if first == "" || first == paused || set != first {
+		t.Errorf("new visitor: variant %s, cookie %q", first, set)
+	}
+	for i := 0; i < 5; i++ {
+		if again, _ := pick("", scanInfo{VisitorHash: "visitor-2"}); again != first {
+			t.Errorf("repeat scan picked %s, then %s", first, again)
+		}
+	}
+	if got, set := pick("", scanInfo{Private: true}); got == "" || got == paused || set != "" {
+		t.Errorf("private scan: variant %s, cookie %q", got, set)
+	}
+
+	// Without any weight left, no variant applies
+	db.Exec("UPDATE qr_variants SET weight = 0")
+	if got, set := pick(a, scanInfo{VisitorHash: "visitor-1"}); got != "" || set != "" {
+		t.Errorf("all weights 0: variant %s, cookie %q", got, set)
+	}
+}
+
+func TestVariantUniqueScansMatchRollups(t *testing.T) {
+	db := openTestDB(t)
+	h := &Handler{db: db}
+	qr := insertTestQR(t, db, "split", accessOpen, nil)
+	db.Exec("INSERT INTO qr_variants (qr_code_id, name, target_url, weight) VALUES (?, 'a', 'https://example.com/a', 1), (?, 'b', 'https://example.com/b', 1)",
+		qr.ID, qr.ID)
+
+	for _, scan := range []struct {
+		variant   int
+		visitor   interface{}
+		eventType string
+		at        string
+	}{
+		{1, "v1", eventRedirect, "2026-01-05 10:00:00"},
+		{1, "v1", eventRedirect, "2026-01-05 11:00:00"},
+		{2, "v1", eventRedirect, "2026-01-05 12:00:00"},
+		{1, "v1", eventRedirect, "2026-01-06 09:00:00"},
+		{2, "v2", eventPaused, "2026-01-06 09:00:00"},
+		{2, "v2", eventRedirect, "2026-01-06 10:00:00"},
+		{2, nil, eventRedirect, "2026-01-06 11:00:00"},
+	} {
+		if _, err := db.Exec("INSERT INTO qr_scans (qr_code_id, variant_id, visitor_hash, event_type, scanned_at) VALUES (?, ?, ?, ?, ?)",
+			qr.ID, scan.variant, scan.visitor, scan.eventType, scan.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rollups.Rebuild(db, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := h.variantAnalytics(qr.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Scans != 3 || stats[0].UniqueScans != 2 || stats[1].Scans != 3 || stats[1].UniqueScans != 1 {
+		t.Fatalf("variant stats %+v", stats)
+	}
+	var unique int
+	db.QueryRow("SELECT SUM(unique_scans) FROM scan_rollups WHERE qr_code_id = ? AND dimension = ?", qr.ID, rollups.Total).Scan(&unique)
+	if unique != stats[0].UniqueScans+stats[1].UniqueScans {
+		t.Errorf("rollups count %d unique scans, variants %d and %d", unique, stats[0].UniqueScans, stats[1].UniqueScans)
+	}
+}
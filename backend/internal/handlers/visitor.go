@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// visitorSalt returns the salt used to fingerprint visitors on the given
+// day. Salts are random, shared across instances through the database and
+// deleted once the day is over, so yesterday's hashes can no longer be
+// linked back to an IP address.
+func (h *Handler) visitorSalt(now time.Time) ([]byte, error) {
+	day := now.UTC().Format("2006-01-02")
+
+	h.saltMu.Lock()
+	defer h.saltMu.Unlock()
+
+	if h.saltDay == day {
+		return h.salt, nil
+	}
+
+	fresh := make([]byte, 32)
+	if _, err := rand.Read(fresh); err != nil {
+		return nil, err
+	}
+
+	// Another instance may have created today's salt already; keep theirs
+	if _, err := h.db.Exec("INSERT OR IGNORE INTO visitor_salts (day, salt) VALUES (?, ?)",
+		day, hex.EncodeToString(fresh)); err != nil {
+		return nil, err
+	}
+
+	var encoded string
+	if err := h.db.QueryRow("SELECT salt FROM visitor_salts WHERE day = ?", day).Scan(&encoded); err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := h.db.Exec("DELETE FROM visitor_salts WHERE day < ?", day); err != nil {
+		return nil, err
+	}
+
+	h.saltDay = day
+	h.salt = salt
+	return salt, nil
+}
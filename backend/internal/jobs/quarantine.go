@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/safety"
+)
+
+const quarantineInterval = time.Hour
+
+// StartQuarantine rechecks the target URLs of every active or paused QR
+// code against the URL policy in the background, so codes whose targets
+// get blocklisted after creation stop redirecting.
+func StartQuarantine(db *sql.DB, policy *safety.Policy) {
+	go func() {
+		for {
+			quarantined, err := Quarantine(db, policy)
+			if err != nil {
+				log.Printf("Error checking target URLs: %v", err)
+			} else if quarantined > 0 {
+				log.Printf("Quarantine: %d QR codes quarantined", quarantined)
+			}
+			time.Sleep(quarantineInterval)
+		}
+	}()
+}
+
+// Quarantine sets the status of QR codes with a target URL failing the
+// policy to quarantined and returns how many were quarantined. Every
+// target counts: the default, expired URL, redirect rules, schedule
+// entries and split-test variants.
+func Quarantine(db *sql.DB, policy *safety.Policy) (int, error) {
+	rows, err := db.Query(`
+		SELECT q.id, t.target_url FROM qr_codes q
+		JOIN (
+			SELECT id AS qr_code_id, target_url FROM qr_codes WHERE target_url != ''
+			UNION ALL SELECT id, expired_url FROM qr_codes WHERE expired_url IS NOT NULL AND expired_url != ''
+			UNION ALL SELECT qr_code_id, target_url FROM qr_redirect_rules
+			UNION ALL SELECT qr_code_id, target_url FROM qr_schedules
+			UNION ALL SELECT qr_code_id, target_url FROM qr_variants
+		) t ON t.qr_code_id = q.id
+		WHERE q.deleted_at IS NULL AND q.status IN ('active', 'paused')
+		ORDER BY q.id
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	reasons := map[int]string{}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var target string
+		if err := rows.Scan(&id, &target); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if _, done := reasons[id]; done {
+			continue
+		}
+		if err := policy.Check(target); err != nil {
+			reasons[id] = target + ": " + err.Error()
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	quarantined := 0
+	for _, id := range ids {
+		result, err := db.Exec(`UPDATE qr_codes SET status = 'quarantined', quarantine_reason = ?, updated_at = CURRENT_TIMESTAMP
+								WHERE id = ? AND status IN ('active', 'paused')`, reasons[id], id)
+		if err != nil {
+			return quarantined, err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			quarantined++
+		}
+	}
+	return quarantined, nil
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const retentionInterval = time.Hour
+
+// StartRetention runs the scan retention policy in the background.
+// SCAN_RETENTION_DAYS sets how long scans are kept (0 keeps them forever)
+// and can be overridden per QR code. SCAN_RETENTION_MODE chooses whether
+// expired scans are deleted ("delete", the default) or stripped down to
+// the fields needed for aggregate counts ("anonymize").
+func StartRetention(db *sql.DB) {
+	days, mode := RetentionPolicy()
+
+	log.Printf("Scan retention: %d days (mode: %s)", days, mode)
+
+	go func() {
+		for {
+			affected, err := ApplyRetention(db, days, mode)
+			if err != nil {
+				log.Printf("Error applying scan retention: %v", err)
+			} else if affected > 0 {
+				log.Printf("Scan retention: %d scans %sd", affected, mode)
+			}
+			time.Sleep(retentionInterval)
+		}
+	}()
+}
+
+// RetentionPolicy returns the default number of days scans are kept and
+// what happens to them afterwards, "delete" or "anonymize"
+func RetentionPolicy() (int, string) {
+	days, _ := strconv.Atoi(os.Getenv("SCAN_RETENTION_DAYS"))
+	if days < 0 {
+		days = 0
+	}
+	mode := strings.ToLower(os.Getenv("SCAN_RETENTION_MODE"))
+	if mode != "anonymize" {
+		mode = "delete"
+	}
+	return days, mode
+}
+
+// ApplyRetention deletes or anonymizes scans older than the retention
+// period of their QR code and returns the number of scans affected.
+func ApplyRetention(db *sql.DB, defaultDays int, mode string) (int64, error) {
+	expired := `
+		SELECT s.id FROM qr_scans s
+		JOIN qr_codes q ON q.id = s.qr_code_id
+		WHERE COALESCE(q.retention_days, ?) > 0
+		  AND s.scanned_at < DATETIME('now', '-' || COALESCE(q.retention_days, ?) || ' days')
+	`
+
+	var query string
+	if mode == "anonymize" {
+		// Visitor hashes stay: their daily salt is long gone, so they can't
+		// be linked to anyone but still back the unique scan counts
+		query = `UPDATE qr_scans SET ip_address = NULL, user_agent = NULL, city = NULL
+				 WHERE (ip_address IS NOT NULL OR user_agent IS NOT NULL OR city IS NOT NULL)
+				 AND id IN (` + expired + `)`
+	} else {
+		query = `DELETE FROM qr_scans WHERE id IN (` + expired + `)`
+	}
+
+	result, err := db.Exec(query, defaultDays, defaultDays)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
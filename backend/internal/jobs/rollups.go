@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/GridexX/qr-tracker/internal/rollups"
+)
+
+const rollupBackfillInterval = time.Hour
+
+// StartRollupBackfill adds the days missing from the scan rollups in the
+// background, on start and then every hour. This covers databases upgraded
+// with scans already stored, and resumes a backfill cut short by a restart,
+// since each code day is committed as it is computed.
+func StartRollupBackfill(db *sql.DB) {
+	go func() {
+		for {
+			days, err := rollups.Backfill(db)
+			if err != nil {
+				log.Printf("Error backfilling scan rollups after %d code days: %v", days, err)
+			} else if days > 0 {
+				log.Printf("Scan rollups: %d code days backfilled", days)
+			}
+			time.Sleep(rollupBackfillInterval)
+		}
+	}()
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	trashPurgeInterval = time.Hour
+	defaultTrashDays   = 30
+)
+
+// qrDependentTables hold rows belonging to a QR code. SQLite doesn't
+// enforce the foreign keys, so they are deleted along with the code.
+var qrDependentTables = []string{
+	"qr_conversions",
+	"qr_code_tags",
+	"qr_code_domains",
+	"qr_scans",
+	"scan_rollups",
+	"qr_variants",
+	"qr_schedules",
+	"qr_redirect_rules",
+}
+
+// StartTrashPurge permanently deletes QR codes that have been in the trash
+// for longer than TRASH_RETENTION_DAYS (30 by default, 0 keeps them until
+// restored), together with their scans and image.
+func StartTrashPurge(db *sql.DB) {
+	days := defaultTrashDays
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			days = parsed
+		}
+	}
+
+	log.Printf("Trash retention: %d days", days)
+	if days == 0 {
+		return
+	}
+
+	go func() {
+		for {
+			purged, err := PurgeTrash(db, days)
+			if err != nil {
+				log.Printf("Error purging trash: %v", err)
+			} else if purged > 0 {
+				log.Printf("Trash purge: %d QR codes deleted", purged)
+			}
+			time.Sleep(trashPurgeInterval)
+		}
+	}()
+}
+
+// PurgeTrash deletes QR codes trashed more than days ago and returns how
+// many were deleted. Their codes can be issued again afterwards.
+func PurgeTrash(db *sql.DB, days int) (int, error) {
+	rows, err := db.Query(`SELECT id, code FROM qr_codes
+						   WHERE deleted_at IS NOT NULL AND deleted_at < DATETIME('now', '-' || ? || ' days')`, days)
+	if err != nil {
+		return 0, err
+	}
+
+	type trashed struct {
+		id   int
+		code string
+	}
+	var expired []trashed
+	for rows.Next() {
+		var qr trashed
+		if err := rows.Scan(&qr.id, &qr.code); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, qr)
+	}
+	rows.Close()
+
+	purged := 0
+	for _, qr := range expired {
+		if err := deleteQRCode(db, qr.id); err != nil {
+			return purged, err
+		}
+		os.Remove(fmt.Sprintf("./data/qr_images/%s.png", qr.code))
+		purged++
+	}
+	return purged, nil
+}
+
+// deleteQRCode removes a QR code and everything recorded for it in one
+// transaction
+func deleteQRCode(db *sql.DB, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range qrDependentTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE qr_code_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM qr_codes WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
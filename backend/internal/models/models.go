@@ -1,20 +1,51 @@
-
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type QRCode struct {
-	ID              int       `json:"id"`
-	Code            string    `json:"code"`
-	Title           string    `json:"title"`
-	TargetURL       string    `json:"target_url"`
-	BackgroundColor string    `json:"background_color"`
-	ForegroundColor string    `json:"foreground_color"`
-	Size            int       `json:"size"`
-	LogoPath        string    `json:"logo_path,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-	TotalScans      int       `json:"total_scans,omitempty"`
+	ID               int        `json:"id"`
+	Code             string     `json:"code"`
+	Title            string     `json:"title"`
+	TargetURL        string     `json:"target_url"`
+	BackgroundColor  string     `json:"background_color"`
+	ForegroundColor  string     `json:"foreground_color"`
+	Size             int        `json:"size"`
+	LogoPath         string     `json:"logo_path,omitempty"`
+	RetentionDays    *int       `json:"retention_days,omitempty"`
+	AnalyticsSinks   []string   `json:"analytics_sinks"`
+	Timezone         string     `json:"timezone,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	ExpiredURL       string     `json:"expired_url,omitempty"`
+	TrackConversions bool       `json:"track_conversions"`
+	AccessMode       string     `json:"access_mode"`
+	MaxScans         *int       `json:"max_scans,omitempty"`
+	RedirectCount    int        `json:"redirect_count"`
+	Status           string     `json:"status"`
+	QuarantineReason string     `json:"quarantine_reason,omitempty"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	DomainID         *int       `json:"domain_id,omitempty"`
+	ShortURL         string     `json:"short_url,omitempty"`
+
+	// PayloadType is "url" for codes that redirect to their target URL
+	// through the tracker. Dynamic vCard codes link to a contact page served
+	// by the tracker; static codes encode their payload directly. Content is
+	// what the image encodes either way.
+	PayloadType string          `json:"payload_type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Dynamic     bool            `json:"dynamic"`
+	Content     string          `json:"content"`
+	Tags        []string        `json:"tags,omitempty"`
+	FolderID    *int            `json:"folder_id,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	TotalScans  int             `json:"total_scans,omitempty"`
+	UniqueScans int             `json:"unique_scans,omitempty"`
+
+	UTMParams
 }
 
 type QRScan struct {
@@ -26,15 +57,216 @@ type QRScan struct {
 	City       string    `json:"city,omitempty"`
 	Browser    string    `json:"browser,omitempty"`
 	DeviceType string    `json:"device_type,omitempty"`
+	OS         string    `json:"os,omitempty"`
+	RuleID     *int      `json:"rule_id,omitempty"`
+	VariantID  *int      `json:"variant_id,omitempty"`
+	Referrer   string    `json:"referrer,omitempty"`
+	IsBot      bool      `json:"is_bot"`
+	EventType  string    `json:"event_type"`
 	ScannedAt  time.Time `json:"scanned_at"`
 }
 
+// QRScanPage is a page of a QR code's scan history. NextCursor fetches the
+// following page and is empty on the last one.
+type QRScanPage struct {
+	Scans      []QRScan `json:"scans"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// CreateQRRequest creates a QR code, or updates one: fields an update
+// leaves out keep their values
 type CreateQRRequest struct {
-	Title           string `json:"title" binding:"required"`
-	TargetURL       string `json:"target_url" binding:"required"`
-	BackgroundColor string `json:"background_color"`
-	ForegroundColor string `json:"foreground_color"`
-	Size            int    `json:"size"`
+	Title           string   `json:"title" binding:"required"`
+	TargetURL       string   `json:"target_url"`
+	BackgroundColor string   `json:"background_color"`
+	ForegroundColor string   `json:"foreground_color"`
+	Size            int      `json:"size"`
+	RetentionDays   *int     `json:"retention_days" binding:"omitempty,min=0"`
+	AnalyticsSinks  []string `json:"analytics_sinks" binding:"omitempty,dive,oneof=ga4 plausible umami matomo webhook"`
+	UTMParams
+	// Timezone is an IANA name used for expires_at and schedule times
+	// given without a UTC offset
+	Timezone   string `json:"timezone"`
+	ExpiresAt  string `json:"expires_at"`
+	ExpiredURL string `json:"expired_url"`
+
+	TrackConversions bool `json:"track_conversions"`
+
+	// AccessMode restricts redirects: "password" asks for Password first,
+	// "max_scans" allows MaxScans redirects and "one_time" a single one
+	AccessMode string `json:"access_mode" binding:"omitempty,oneof=open password max_scans one_time"`
+	Password   string `json:"password" binding:"max=72"`
+	MaxScans   *int   `json:"max_scans" binding:"omitempty,min=1"`
+
+	// DomainID picks the custom domain encoded in the image, 0 for none.
+	// New codes default to the default domain; updates keep the current one.
+	DomainID *int `json:"domain_id"`
+
+	// PayloadType defaults to "url", which requires TargetURL. The other
+	// types take their fields in Payload.
+	PayloadType string          `json:"payload_type" binding:"omitempty,oneof=url vcard mecard wifi email sms geo event"`
+	Payload     json.RawMessage `json:"payload"`
+	// Dynamic makes a vcard code link to a tracked contact page, so its
+	// fields can change after printing. URL codes are always dynamic.
+	// Like PayloadType, it can't change once the code is printed.
+	Dynamic *bool `json:"dynamic"`
+
+	// A folder_id of 0 takes a code out of its folder, and a null metadata
+	// clears it.
+	Tags     []string        `json:"tags"`
+	FolderID *int            `json:"folder_id" binding:"omitempty,min=0"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// UTMParams are campaign parameters merged into the target URL on redirect
+type UTMParams struct {
+	Source   string `json:"utm_source,omitempty" binding:"max=200"`
+	Medium   string `json:"utm_medium,omitempty" binding:"max=200"`
+	Campaign string `json:"utm_campaign,omitempty" binding:"max=200"`
+	Term     string `json:"utm_term,omitempty" binding:"max=200"`
+	Content  string `json:"utm_content,omitempty" binding:"max=200"`
+}
+
+// RedirectRule sends clients matching one of its comma-separated values
+// to its own target URL. Rules are evaluated in position order.
+type RedirectRule struct {
+	ID        int    `json:"id"`
+	Position  int    `json:"position"`
+	Field     string `json:"field" binding:"required,oneof=device_type os language country"`
+	Value     string `json:"value" binding:"required"`
+	TargetURL string `json:"target_url" binding:"required"`
+}
+
+type RedirectRulesRequest struct {
+	Rules []RedirectRule `json:"rules" binding:"dive"`
+}
+
+// ScheduleEntry redirects to its target URL between StartsAt and EndsAt.
+// A missing bound leaves the window open on that side.
+type ScheduleEntry struct {
+	ID        int        `json:"id"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+	TargetURL string     `json:"target_url"`
+}
+
+type ScheduleEntryRequest struct {
+	StartsAt  string `json:"starts_at"`
+	EndsAt    string `json:"ends_at"`
+	TargetURL string `json:"target_url" binding:"required"`
+}
+
+type ScheduleRequest struct {
+	Entries []ScheduleEntryRequest `json:"entries" binding:"dive"`
+}
+
+// Variant is one of the weighted destinations of a split-tested QR code
+type Variant struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name" binding:"required"`
+	TargetURL string `json:"target_url" binding:"required"`
+	Weight    int    `json:"weight" binding:"min=0"`
+}
+
+type VariantsRequest struct {
+	Variants []Variant `json:"variants" binding:"dive"`
+}
+
+type StatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active paused archived"`
+}
+
+// ConversionRequest reports a conversion for the scan behind a click ID
+type ConversionRequest struct {
+	ClickID string  `json:"click_id" binding:"required"`
+	Event   string  `json:"event" binding:"max=100"`
+	Value   float64 `json:"value"`
+}
+
+// Domain is a custom domain QR codes can redirect from
+type Domain struct {
+	ID        int       `json:"id"`
+	Hostname  string    `json:"hostname"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	QRCodes   int       `json:"qr_codes"`
+}
+
+type DomainRequest struct {
+	Hostname  string `json:"hostname" binding:"required"`
+	IsDefault bool   `json:"is_default"`
+}
+
+type DefaultDomainRequest struct {
+	IsDefault bool `json:"is_default"`
+}
+
+// BulkJob tracks the images of QR codes created in one bulk request
+type BulkJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Completed  int        `json:"completed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	QRCodes    []QRCode   `json:"qr_codes,omitempty"`
+}
+
+// BulkRowError is why a row of a bulk request was rejected. Rows are
+// numbered from 1, not counting a CSV header.
+type BulkRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ExportRequest selects QR codes to print and the file to print them from:
+// a ZIP of images, or a PDF label sheet. Codes are picked by ID, or else
+// by tags and folder.
+type ExportRequest struct {
+	IDs         []int        `json:"ids"`
+	Tags        []string     `json:"tags"`
+	FolderID    *int         `json:"folder_id"`
+	Format      string       `json:"format" binding:"omitempty,oneof=zip pdf"`
+	ImageFormat string       `json:"image_format" binding:"omitempty,oneof=png svg"`
+	NameBy      string       `json:"name_by" binding:"omitempty,oneof=code title"`
+	Sheet       SheetOptions `json:"sheet"`
+}
+
+// SheetOptions lay out a PDF label sheet. Lengths are in millimeters.
+type SheetOptions struct {
+	PageSize  string   `json:"page_size" binding:"omitempty,oneof=a4 letter"`
+	Columns   int      `json:"columns" binding:"omitempty,min=1,max=20"`
+	Rows      int      `json:"rows" binding:"omitempty,min=1,max=30"`
+	Margin    *float64 `json:"margin" binding:"omitempty,min=0,max=50"`
+	Gap       *float64 `json:"gap" binding:"omitempty,min=0,max=50"`
+	Caption   string   `json:"caption" binding:"omitempty,oneof=title code none"`
+	CropMarks bool     `json:"crop_marks"`
+}
+
+// Tag labels QR codes. Tags are created when first used.
+type Tag struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	QRCodes int    `json:"qr_codes"`
+}
+
+// Folder groups QR codes. Folders nest under their parent; Path joins the
+// names from the top folder down with "/".
+type Folder struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *int      `json:"parent_id,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	QRCodes   int       `json:"qr_codes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FolderRequest creates or updates a folder. Updates keep the parent
+// unless parent_id is given; a parent_id of 0 moves it to the top level.
+type FolderRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	ParentID *int   `json:"parent_id" binding:"omitempty,min=0"`
 }
 
 type LoginRequest struct {
@@ -48,21 +280,96 @@ type LoginResponse struct {
 }
 
 type AnalyticsOverview struct {
-	TotalQRCodes   int `json:"total_qr_codes"`
-	TotalScans     int `json:"total_scans"`
-	ScansToday     int `json:"scans_today"`
-	ScansThisWeek  int `json:"scans_this_week"`
-	ScansThisMonth int `json:"scans_this_month"`
+	TotalQRCodes         int `json:"total_qr_codes"`
+	TotalScans           int `json:"total_scans"`
+	ScansToday           int `json:"scans_today"`
+	ScansThisWeek        int `json:"scans_this_week"`
+	ScansThisMonth       int `json:"scans_this_month"`
+	UniqueScans          int `json:"unique_scans"`
+	UniqueScansToday     int `json:"unique_scans_today"`
+	UniqueScansThisWeek  int `json:"unique_scans_this_week"`
+	UniqueScansThisMonth int `json:"unique_scans_this_month"`
+}
+
+type TagAnalytics struct {
+	Tag         string `json:"tag"`
+	QRCodes     int    `json:"qr_codes"`
+	TotalScans  int    `json:"total_scans"`
+	UniqueScans int    `json:"unique_scans"`
 }
 
 type TimeSeriesData struct {
-	Date  string `json:"date"`
-	Scans int    `json:"scans"`
+	Date        string `json:"date"`
+	Scans       int    `json:"scans"`
+	UniqueScans int    `json:"unique_scans"`
+}
+
+// TimeSeries is the scans of one QR code, or of every code in scope, per
+// time bucket. Previous is the same series over the period just before,
+// when asked for, and Change the growth in total scans since then in
+// percent.
+type TimeSeries struct {
+	QRCodeID   *int             `json:"qr_code_id,omitempty"`
+	TotalScans int              `json:"total_scans"`
+	Points     []TimeSeriesData `json:"points"`
+	Previous   *TimeSeries      `json:"previous,omitempty"`
+	Change     *float64         `json:"change,omitempty"`
+}
+
+type TimeSeriesResponse struct {
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	Granularity string       `json:"granularity"`
+	Timezone    string       `json:"timezone"`
+	Series      []TimeSeries `json:"series"`
+}
+
+type CampaignAnalytics struct {
+	Campaign    string `json:"campaign"`
+	QRCodes     int    `json:"qr_codes"`
+	TotalScans  int    `json:"total_scans"`
+	UniqueScans int    `json:"unique_scans"`
+}
+
+// Breakdown splits scans by the values of a dimension, most scanned first.
+// Values past the limit are summed up in a last value marked Other.
+type Breakdown struct {
+	Dimension  string           `json:"dimension"`
+	TotalScans int              `json:"total_scans"`
+	Values     []BreakdownValue `json:"values"`
+}
+
+type BreakdownValue struct {
+	Value      string  `json:"value"`
+	Scans      int     `json:"scans"`
+	Percentage float64 `json:"percentage"`
+	Other      bool    `json:"other,omitempty"`
+}
+
+type VariantAnalytics struct {
+	VariantID   int    `json:"variant_id"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url"`
+	Weight      int    `json:"weight"`
+	Scans       int    `json:"scans"`
+	UniqueScans int    `json:"unique_scans"`
+
+	Conversions     int     `json:"conversions"`
+	ConversionRate  float64 `json:"conversion_rate"`
+	ConversionValue float64 `json:"conversion_value"`
 }
 
 type QRAnalytics struct {
-	QRCode      QRCode           `json:"qr_code"`
-	TotalScans  int              `json:"total_scans"`
-	RecentScans []QRScan         `json:"recent_scans"`
-	TimeSeries  []TimeSeriesData `json:"time_series"`
-}
\ No newline at end of file
+	QRCode      QRCode `json:"qr_code"`
+	TotalScans  int    `json:"total_scans"`
+	UniqueScans int    `json:"unique_scans"`
+
+	// ConversionRate is the share of scans with at least one conversion
+	Conversions     int     `json:"conversions"`
+	ConversionRate  float64 `json:"conversion_rate"`
+	ConversionValue float64 `json:"conversion_value"`
+
+	RecentScans []QRScan           `json:"recent_scans"`
+	TimeSeries  []TimeSeriesData   `json:"time_series"`
+	Variants    []VariantAnalytics `json:"variants"`
+}
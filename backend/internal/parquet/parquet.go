@@ -0,0 +1,331 @@
+// Package parquet writes flat tables as Apache Parquet files. Rows are
+// buffered one row group at a time and written as soon as the group is
+// full, so tables of any length are streamed.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Type is the type of a column
+type Type int
+
+const (
+	// Int64 columns hold int64 values
+	Int64 Type = iota
+	// String columns hold UTF-8 string values
+	String
+	// Timestamp columns hold time.Time values, stored as UTC milliseconds
+	Timestamp
+)
+
+// Column describes a column of the table. Values of optional columns may
+// be nil.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+// DefaultRowGroupSize is the number of rows buffered before a row group
+// is written
+const DefaultRowGroupSize = 10000
+
+const magic = "PAR1"
+
+// Parquet enum values used by the writer
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip    = 2
+	pageTypeData = 0
+)
+
+// Writer writes rows to a Parquet file
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	err     error
+	columns []Column
+
+	// RowGroupSize is the number of rows in each row group
+	RowGroupSize int
+
+	chunks    []chunk
+	rows      int
+	totalRows int64
+	rowGroups []rowGroup
+}
+
+// chunk buffers the values of a column in the current row group
+type chunk struct {
+	defined []bool
+	values  bytes.Buffer
+}
+
+// columnMeta records where a column chunk was written
+type columnMeta struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	columns []columnMeta
+	rows    int64
+}
+
+// NewWriter prepares a Parquet file written to w. Nothing is written
+// until the first row or Close.
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	return &Writer{
+		w:            w,
+		columns:      columns,
+		RowGroupSize: DefaultRowGroupSize,
+		chunks:       make([]chunk, len(columns)),
+	}
+}
+
+func (p *Writer) write(data []byte) {
+	if p.err != nil {
+		return
+	}
+	if p.offset == 0 {
+		n, err := io.WriteString(p.w, magic)
+		p.offset += int64(n)
+		if p.err = err; err != nil {
+			return
+		}
+	}
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// Write adds a row, with a value for each column in order
+func (p *Writer) Write(row []interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(row) != len(p.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(p.columns))
+	}
+
+	for i, column := range p.columns {
+		if err := p.chunks[i].add(column, row[i]); err != nil {
+			return err
+		}
+	}
+	p.rows++
+	if p.rows >= p.RowGroupSize {
+		p.flushRowGroup()
+	}
+	return p.err
+}
+
+func (c *chunk) add(column Column, value interface{}) error {
+	if value == nil {
+		if !column.Optional {
+			return fmt.Errorf("parquet: column %s is required", column.Name)
+		}
+		c.defined = append(c.defined, false)
+		return nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if column.Type != Int64 {
+			return fmt.Errorf("parquet: int64 value in column %s", column.Name)
+		}
+		c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+	case string:
+		if column.Type != String {
+			return fmt.Errorf("parquet: string value in column %s", column.Name)
+		}
+		c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+		c.values.WriteString(v)
+	case time.Time:
+		if column.Type != Timestamp {
+			return fmt.Errorf("parquet: time value in column %s", column.Name)
+		}
+		c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v.UnixMilli())))
+	default:
+		return fmt.Errorf("parquet: unsupported %T value in column %s", value, column.Name)
+	}
+	if column.Optional {
+		c.defined = append(c.defined, true)
+	}
+	return nil
+}
+
+// flushRowGroup writes the buffered rows as a row group, one data page
+// per column
+func (p *Writer) flushRowGroup() {
+	group := rowGroup{rows: int64(p.rows)}
+	for i, column := range p.columns {
+		var page bytes.Buffer
+		if column.Optional {
+			levels := definitionLevels(p.chunks[i].defined)
+			page.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(levels))))
+			page.Write(levels)
+		}
+		page.Write(p.chunks[i].values.Bytes())
+
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page.Bytes())
+		gz.Close()
+
+		header := newCompact()
+		header.i32(1, pageTypeData)
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(compressed.Len()))
+		header.begin(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.end()
+		headerBytes := header.bytes()
+
+		meta := columnMeta{offset: p.offset}
+		if meta.offset == 0 {
+			meta.offset = int64(len(magic))
+		}
+		p.write(headerBytes)
+		p.write(compressed.Bytes())
+		meta.uncompressedSize = int64(len(headerBytes) + page.Len())
+		meta.compressedSize = int64(len(headerBytes) + compressed.Len())
+		group.columns = append(group.columns, meta)
+
+		p.chunks[i].defined = p.chunks[i].defined[:0]
+		p.chunks[i].values.Reset()
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.totalRows += int64(p.rows)
+	p.rows = 0
+}
+
+// definitionLevels encodes whether each value is present as a single
+// bit-packed run of the RLE/bit-packing hybrid encoding, with bit width 1
+func definitionLevels(defined []bool) []byte {
+	groups := (len(defined) + 7) / 8
+	levels := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, ok := range defined {
+		if ok {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(levels, packed...)
+}
+
+// Close writes the last row group and the file footer
+func (p *Writer) Close() error {
+	if p.rows > 0 {
+		p.flushRowGroup()
+	}
+
+	footer := newCompact()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(p.columns)+1)
+	footer.element()
+	footer.str(4, "schema")
+	footer.i32(5, int32(len(p.columns)))
+	footer.end()
+	for _, column := range p.columns {
+		footer.element()
+		writeSchemaElement(footer, column)
+		footer.end()
+	}
+	footer.i64(3, p.totalRows)
+	footer.list(4, thriftStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		footer.element()
+		footer.list(1, thriftStruct, len(group.columns))
+		var totalSize int64
+		for i, meta := range group.columns {
+			footer.element()
+			footer.i64(2, meta.offset)
+			footer.begin(3)
+			footer.i32(1, physicalType(p.columns[i].Type))
+			footer.list(2, thriftI32, 2)
+			footer.listI32(encodingPlain)
+			footer.listI32(encodingRLE)
+			footer.list(3, thriftBinary, 1)
+			footer.listStr(p.columns[i].Name)
+			footer.i32(4, codecGzip)
+			footer.i64(5, group.rows)
+			footer.i64(6, meta.uncompressedSize)
+			footer.i64(7, meta.compressedSize)
+			footer.i64(9, meta.offset)
+			footer.end()
+			footer.end()
+			totalSize += meta.uncompressedSize
+		}
+		footer.i64(2, totalSize)
+		footer.i64(3, group.rows)
+		footer.end()
+	}
+	footer.str(6, "qr-tracker")
+	footerBytes := footer.bytes()
+
+	p.write(footerBytes)
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footerBytes))))
+	p.write([]byte(magic))
+	return p.err
+}
+
+func physicalType(t Type) int32 {
+	if t == String {
+		return typeByteArray
+	}
+	return typeInt64
+}
+
+// writeSchemaElement describes a column, with both its converted type and
+// its logical type for older and newer readers
+func writeSchemaElement(t *compact, column Column) {
+	t.i32(1, physicalType(column.Type))
+	if column.Optional {
+		t.i32(3, repetitionOptional)
+	} else {
+		t.i32(3, repetitionRequired)
+	}
+	t.str(4, column.Name)
+
+	switch column.Type {
+	case String:
+		t.i32(6, convertedUTF8)
+		t.begin(10)
+		t.begin(1)
+		t.end()
+		t.end()
+	case Timestamp:
+		t.i32(6, convertedTimestampMillis)
+		t.begin(10)
+		t.begin(8)
+		t.boolean(1, true)
+		t.begin(2)
+		t.begin(1)
+		t.end()
+		t.end()
+		t.end()
+		t.end()
+	}
+}
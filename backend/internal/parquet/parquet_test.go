@@ -0,0 +1,283 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The reader below follows the Parquet format specification on its own,
+// decoding Thrift structs generically into field ID maps, so the writer is
+// checked against the spec rather than against its own encoder.
+
+// thriftReader decodes the Thrift compact protocol
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	v := r.b[r.pos]
+	r.pos++
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 8:
+		n := int(r.uvarint())
+		v := r.b[r.pos : r.pos+n]
+		r.pos += n
+		return v
+	case 9:
+		header := r.byte()
+		n, elem := int(header>>4), header&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case 12:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(typ)
+		last = id
+	}
+}
+
+// levels decodes n values of the RLE/bit-packing hybrid encoding with a
+// bit width of 1
+func levels(b []byte, n int) []bool {
+	r := &thriftReader{b: b}
+	var out []bool
+	for len(out) < n {
+		header := r.uvarint()
+		if header&1 == 0 {
+			run, value := int(header>>1), r.byte() == 1
+			for i := 0; i < run; i++ {
+				out = append(out, value)
+			}
+			continue
+		}
+		for i := 0; i < int(header>>1); i++ {
+			packed := r.byte()
+			for bit := 0; bit < 8; bit++ {
+				out = append(out, packed&(1<<bit) != 0)
+			}
+		}
+	}
+	return out[:n]
+}
+
+// readFile reads every row of a Parquet file, after checking its schema
+// against columns
+func readFile(t *testing.T, file []byte, columns []Column) [][]interface{} {
+	t.Helper()
+	if string(file[:4]) != "PAR1" || string(file[len(file)-4:]) != "PAR1" {
+		t.Fatal("missing magic")
+	}
+	size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta := (&thriftReader{b: file[len(file)-8-size : len(file)-8]}).structure()
+
+	schema := meta[2].([]interface{})
+	if root := schema[0].(map[int16]interface{}); root[5] != int64(len(columns)) {
+		t.Fatalf("root has %v children, want %d", root[5], len(columns))
+	}
+	for i, column := range columns {
+		element := schema[i+1].(map[int16]interface{})
+		repetition := int64(repetitionRequired)
+		if column.Optional {
+			repetition = repetitionOptional
+		}
+		converted := map[Type]interface{}{String: int64(convertedUTF8), Timestamp: int64(convertedTimestampMillis)}[column.Type]
+		if string(element[4].([]byte)) != column.Name || element[1] != int64(physicalType(column.Type)) ||
+			element[3] != repetition || element[6] != converted {
+			t.Errorf("schema element %d = %v", i, element)
+		}
+	}
+
+	var rows [][]interface{}
+	for _, group := range meta[4].([]interface{}) {
+		group := group.(map[int16]interface{})
+		count := int(group[3].(int64))
+		values := make([][]interface{}, len(columns))
+		for i, chunk := range group[1].([]interface{}) {
+			chunkMeta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			if chunkMeta[4] != int64(codecGzip) || chunkMeta[5] != int64(count) {
+				t.Fatalf("column chunk %v", chunkMeta)
+			}
+			offset := chunkMeta[9].(int64)
+			r := &thriftReader{b: file, pos: int(offset)}
+			header := r.structure()
+			compressedSize := int(header[3].(int64))
+			if header[1] != int64(pageTypeData) || r.pos-int(offset)+compressedSize != int(chunkMeta[7].(int64)) {
+				t.Fatalf("page header %v", header)
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(file[r.pos : r.pos+compressedSize]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := io.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) != int(header[2].(int64)) {
+				t.Fatalf("page is %d bytes, header says %v", len(page), header[2])
+			}
+			values[i] = readPage(page, columns[i], count)
+		}
+		for row := 0; row < count; row++ {
+			var fields []interface{}
+			for i := range columns {
+				fields = append(fields, values[i][row])
+			}
+			rows = append(rows, fields)
+		}
+	}
+	if total := meta[3].(int64); total != int64(len(rows)) {
+		t.Errorf("num_rows = %d, read %d", total, len(rows))
+	}
+	return rows
+}
+
+// readPage decodes a plain encoded data page
+func readPage(page []byte, column Column, count int) []interface{} {
+	defined := make([]bool, count)
+	for i := range defined {
+		defined[i] = true
+	}
+	if column.Optional {
+		size := int(binary.LittleEndian.Uint32(page))
+		defined = levels(page[4:4+size], count)
+		page = page[4+size:]
+	}
+
+	values := make([]interface{}, count)
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch column.Type {
+		case Int64:
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case Timestamp:
+			values[i] = time.UnixMilli(int64(binary.LittleEndian.Uint64(page))).UTC()
+			page = page[8:]
+		case String:
+			n := int(binary.LittleEndian.Uint32(page))
+			values[i] = string(page[4 : 4+n])
+			page = page[4+n:]
+		}
+	}
+	return values
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Type: Int64},
+		{Name: "code", Type: String},
+		{Name: "scanned_at", Type: Timestamp},
+		{Name: "country", Type: String, Optional: true},
+		{Name: "rule_id", Type: Int64, Optional: true},
+	}
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var rows [][]interface{}
+	for i := 0; i < 23; i++ {
+		row := []interface{}{int64(i), fmt.Sprintf("code-%d", i), start.Add(time.Duration(i) * time.Minute), nil, nil}
+		if i%3 == 0 {
+			row[3] = "Côte d'Ivoire"
+		}
+		if i%4 == 1 {
+			row[4] = int64(-i)
+		}
+		rows = append(rows, row)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		rowGroupSize int
+		rows         [][]interface{}
+	}{
+		{"single row group", DefaultRowGroupSize, rows},
+		{"several row groups", 10, rows},
+		{"empty file", DefaultRowGroupSize, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var file bytes.Buffer
+			w := NewWriter(&file, columns)
+			w.RowGroupSize = tc.rowGroupSize
+			for _, row := range tc.rows {
+				if err := w.Write(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := readFile(t, file.Bytes(), columns)
+			if !reflect.DeepEqual(got, tc.rows) {
+				t.Errorf("read %v\nwant %v", got, tc.rows)
+			}
+		})
+	}
+}
+
+func TestWriterRejectsInvalidValues(t *testing.T) {
+	columns := []Column{{Name: "id", Type: Int64}, {Name: "code", Type: String, Optional: true}}
+	for _, row := range [][]interface{}{
+		{nil, "abc"},
+		{"1", "abc"},
+		{int64(1), int64(2)},
+		{int64(1)},
+	} {
+		if err := NewWriter(io.Discard, columns).Write(row); err == nil {
+			t.Errorf("row %v was accepted", row)
+		}
+	}
+}
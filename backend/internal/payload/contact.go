@@ -0,0 +1,235 @@
+package payload
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Contact holds the fields shared by vCard and MeCard payloads
+type Contact struct {
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Organization string `json:"organization,omitempty"`
+	JobTitle     string `json:"job_title,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Mobile       string `json:"mobile,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Website      string `json:"website,omitempty"`
+	Street       string `json:"street,omitempty"`
+	City         string `json:"city,omitempty"`
+	Region       string `json:"region,omitempty"`
+	PostalCode   string `json:"postal_code,omitempty"`
+	Country      string `json:"country,omitempty"`
+	Note         string `json:"note,omitempty"`
+}
+
+// FullName is the display name of the contact
+func (c Contact) FullName() string {
+	name := strings.TrimSpace(c.FirstName + " " + c.LastName)
+	if name == "" {
+		return c.Organization
+	}
+	return name
+}
+
+func (c Contact) validate() error {
+	if c.FullName() == "" {
+		return fmt.Errorf("first_name, last_name or organization is required")
+	}
+	for _, phone := range []string{c.Phone, c.Mobile} {
+		if phone != "" && !validPhone(phone) {
+			return fmt.Errorf("invalid phone number %q", phone)
+		}
+	}
+	if c.Email != "" {
+		if _, err := mail.ParseAddress(c.Email); err != nil {
+			return fmt.Errorf("invalid email %q", c.Email)
+		}
+	}
+	if c.Website != "" && !validWebsite(c.Website) {
+		return fmt.Errorf("website must be an absolute http or https URL")
+	}
+	return nil
+}
+
+func (c Contact) hasAddress() bool {
+	return c.Street != "" || c.City != "" || c.Region != "" || c.PostalCode != "" || c.Country != ""
+}
+
+// AddressLines is the postal address of the contact, one line per
+// non-empty part
+func (c Contact) AddressLines() []string {
+	return nonEmpty(c.Street, strings.TrimSpace(c.PostalCode+" "+c.City), c.Region, c.Country)
+}
+
+// VCardPayload is a contact card in vCard 3.0 (RFC 2426) or 4.0 (RFC 6350)
+// format, 4.0 by default
+type VCardPayload struct {
+	Version string `json:"version,omitempty"`
+	Contact
+}
+
+func (v *VCardPayload) Encode() (string, error) {
+	if v.Version == "" {
+		v.Version = "4.0"
+	}
+	if v.Version != "3.0" && v.Version != "4.0" {
+		return "", fmt.Errorf("version must be 3.0 or 4.0")
+	}
+	if err := v.validate(); err != nil {
+		return "", err
+	}
+
+	lines := []string{"BEGIN:VCARD", "VERSION:" + v.Version}
+	add := func(property, value string) {
+		if value != "" {
+			lines = append(lines, property+":"+value)
+		}
+	}
+
+	lines = append(lines, "N:"+vcardText(v.LastName)+";"+vcardText(v.FirstName)+";;;")
+	add("FN", vcardText(v.FullName()))
+	add("ORG", vcardText(v.Organization))
+	add("TITLE", vcardText(v.JobTitle))
+	if v.Version == "4.0" {
+		add("TEL;TYPE=work,voice;VALUE=uri", telURI(v.Phone))
+		add("TEL;TYPE=cell;VALUE=uri", telURI(v.Mobile))
+	} else {
+		add("TEL;TYPE=WORK,VOICE", v.Phone)
+		add("TEL;TYPE=CELL", v.Mobile)
+	}
+	add("EMAIL", vcardText(v.Email))
+	add("URL", v.Website)
+	if v.hasAddress() {
+		lines = append(lines, "ADR;TYPE=work:;;"+strings.Join([]string{
+			vcardText(v.Street), vcardText(v.City), vcardText(v.Region), vcardText(v.PostalCode), vcardText(v.Country),
+		}, ";"))
+	}
+	add("NOTE", vcardText(v.Note))
+	lines = append(lines, "END:VCARD")
+
+	for i, line := range lines {
+		lines[i] = foldLine(line)
+	}
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+// MeCardPayload is a contact card in the compact MeCard format
+type MeCardPayload struct {
+	Contact
+}
+
+func (m *MeCardPayload) Encode() (string, error) {
+	if err := m.validate(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("MECARD:")
+	add := func(field, value string) {
+		if value != "" {
+			b.WriteString(field + ":" + mecardText(value) + ";")
+		}
+	}
+
+	name := mecardText(m.FullName())
+	if m.LastName != "" && m.FirstName != "" {
+		name = mecardText(m.LastName) + "," + mecardText(m.FirstName)
+	}
+	b.WriteString("N:" + name + ";")
+	add("ORG", m.Organization)
+	add("TEL", m.Phone)
+	add("TEL", m.Mobile)
+	add("EMAIL", m.Email)
+	add("URL", m.Website)
+	if m.hasAddress() {
+		add("ADR", strings.Join(m.AddressLines(), ", "))
+	}
+	add("NOTE", m.Note)
+	b.WriteString(";")
+	return b.String(), nil
+}
+
+// vcardText escapes a vCard TEXT value
+func vcardText(value string) string {
+	value = escape(value, `\,;`)
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// mecardText escapes a MeCard field value
+func mecardText(value string) string {
+	return strings.ReplaceAll(escape(value, `\;,:"`), "\n", " ")
+}
+
+// telURI turns a phone number into a tel: URI as vCard 4.0 expects
+func telURI(phone string) string {
+	if phone == "" {
+		return ""
+	}
+	return "tel:" + strings.NewReplacer(" ", "-", "(", "", ")", "").Replace(phone)
+}
+
+// foldLine splits content lines longer than 75 octets as RFC 6350
+// requires, without breaking UTF-8 sequences
+func foldLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+func validPhone(phone string) bool {
+	digits := 0
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return false
+		}
+	}
+	return digits >= 3 && digits <= 20
+}
+
+// validWebsite reports whether website is an absolute http(s) URL. It is
+// written to the cards unescaped and linked from the contact page.
+func validWebsite(website string) bool {
+	if strings.IndexFunc(website, unicode.IsControl) >= 0 {
+		return false
+	}
+	u, err := url.Parse(website)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package payload
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventPayload adds an event to the calendar as an iCalendar VEVENT
+// (RFC 5545). Times are RFC 3339 timestamps and encoded in UTC.
+type EventPayload struct {
+	Summary     string     `json:"summary"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	Description string     `json:"description,omitempty"`
+}
+
+const icalTimeFormat = "20060102T150405Z"
+
+func (e *EventPayload) Encode() (string, error) {
+	if err := required("summary", e.Summary); err != nil {
+		return "", err
+	}
+	if e.Start.IsZero() {
+		return "", fmt.Errorf("start is required")
+	}
+	if e.End != nil && e.End.Before(e.Start) {
+		return "", fmt.Errorf("end must not be before start")
+	}
+
+	lines := []string{
+		"BEGIN:VEVENT",
+		"SUMMARY:" + icalText(e.Summary),
+		"DTSTART:" + e.Start.UTC().Format(icalTimeFormat),
+	}
+	if e.End != nil {
+		lines = append(lines, "DTEND:"+e.End.UTC().Format(icalTimeFormat))
+	}
+	if e.Location != "" {
+		lines = append(lines, "LOCATION:"+icalText(e.Location))
+	}
+	if e.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+icalText(e.Description))
+	}
+	lines = append(lines, "END:VEVENT")
+
+	for i, line := range lines {
+		lines[i] = foldLine(line)
+	}
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+// icalText escapes an iCalendar TEXT value, which follows the vCard rules
+func icalText(value string) string {
+	return vcardText(value)
+}
@@ -0,0 +1,37 @@
+package payload
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GeoPayload is a location as a geo: URI (RFC 5870)
+type GeoPayload struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+	// Query labels the location in map apps that support it
+	Query string `json:"query,omitempty"`
+}
+
+func (g *GeoPayload) Encode() (string, error) {
+	if g.Latitude < -90 || g.Latitude > 90 {
+		return "", fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if g.Longitude < -180 || g.Longitude > 180 {
+		return "", fmt.Errorf("longitude must be between -180 and 180")
+	}
+
+	content := "geo:" + formatCoordinate(g.Latitude) + "," + formatCoordinate(g.Longitude)
+	if g.Altitude != nil {
+		content += "," + formatCoordinate(*g.Altitude)
+	}
+	if g.Query != "" {
+		content += "?q=" + queryEscape(g.Query)
+	}
+	return content, nil
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,57 @@
+package payload
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// EmailPayload opens a new email as a mailto: URI (RFC 6068)
+type EmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+func (e *EmailPayload) Encode() (string, error) {
+	if err := required("to", e.To); err != nil {
+		return "", err
+	}
+	address, err := mail.ParseAddress(e.To)
+	if err != nil {
+		return "", fmt.Errorf("invalid email %q", e.To)
+	}
+	e.To = address.Address
+
+	var query []string
+	if e.Subject != "" {
+		query = append(query, "subject="+queryEscape(e.Subject))
+	}
+	if e.Body != "" {
+		query = append(query, "body="+queryEscape(strings.ReplaceAll(e.Body, "\r\n", "\n")))
+	}
+
+	content := "mailto:" + (&url.URL{Path: e.To}).EscapedPath()
+	if len(query) > 0 {
+		content += "?" + strings.Join(query, "&")
+	}
+	return content, nil
+}
+
+// SMSPayload starts a text message in the SMSTO: format
+type SMSPayload struct {
+	Number  string `json:"number"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *SMSPayload) Encode() (string, error) {
+	if err := required("number", s.Number); err != nil {
+		return "", err
+	}
+	if !validPhone(s.Number) {
+		return "", fmt.Errorf("invalid phone number %q", s.Number)
+	}
+	number := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(s.Number)
+	return "SMSTO:" + number + ":" + s.Message, nil
+}
@@ -0,0 +1,129 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Payload types. URL codes are dynamic: they encode a tracked redirect to
+// their target URL. vCard codes may be dynamic too, encoding a tracked link
+// to a contact page. Every other type is static and encodes its content
+// directly.
+const (
+	URL    = "url"
+	VCard  = "vcard"
+	MeCard = "mecard"
+	WiFi   = "wifi"
+	Email  = "email"
+	SMS    = "sms"
+	Geo    = "geo"
+	Event  = "event"
+)
+
+// Encoder turns the structured fields of a payload into QR code content
+type Encoder interface {
+	Encode() (string, error)
+}
+
+// newEncoders returns an empty encoder for each static payload type
+var newEncoders = map[string]func() Encoder{
+	VCard:  func() Encoder { return &VCardPayload{} },
+	MeCard: func() Encoder { return &MeCardPayload{} },
+	WiFi:   func() Encoder { return &WiFiPayload{} },
+	Email:  func() Encoder { return &EmailPayload{} },
+	SMS:    func() Encoder { return &SMSPayload{} },
+	Geo:    func() Encoder { return &GeoPayload{} },
+	Event:  func() Encoder { return &EventPayload{} },
+}
+
+// Dynamic reports whether codes of a payload type go through the tracker
+// rather than encoding their content. URL codes always do; vCard codes do
+// when requested.
+func Dynamic(payloadType string, requested bool) bool {
+	switch payloadType {
+	case "", URL:
+		return true
+	case VCard:
+		return requested
+	}
+	return false
+}
+
+// Parse decodes the fields of a static payload type, rejecting unknown
+// fields
+func Parse(payloadType string, raw json.RawMessage) (Encoder, error) {
+	newEncoder, ok := newEncoders[payloadType]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload type %q", payloadType)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("fields are required for %s codes", payloadType)
+	}
+
+	encoder := newEncoder()
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(encoder); err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// Encode returns the QR code content of a static payload
+func Encode(payloadType string, raw json.RawMessage) (string, error) {
+	encoder, err := Parse(payloadType, raw)
+	if err != nil {
+		return "", err
+	}
+	return encoder.Encode()
+}
+
+// Normalize validates a static payload and returns its QR code content
+// along with its fields re-encoded for storage, defaults filled in
+func Normalize(payloadType string, raw json.RawMessage) (string, json.RawMessage, error) {
+	encoder, err := Parse(payloadType, raw)
+	if err != nil {
+		return "", nil, err
+	}
+	content, err := encoder.Encode()
+	if err != nil {
+		return "", nil, err
+	}
+	normalized, err := json.Marshal(encoder)
+	if err != nil {
+		return "", nil, err
+	}
+	return content, normalized, nil
+}
+
+// required returns an error naming the first empty field
+func required(fields ...string) error {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if strings.TrimSpace(fields[i+1]) == "" {
+			return fmt.Errorf("%s is required", fields[i])
+		}
+	}
+	return nil
+}
+
+// queryEscape percent-encodes a URI query value. Spaces become %20, since
+// apps reading mailto: and geo: URIs don't all take + as a space.
+func queryEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// escape prefixes each of the special characters in value with a
+// backslash
+func escape(value, special string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
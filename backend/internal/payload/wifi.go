@@ -0,0 +1,53 @@
+package payload
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WiFiPayload joins a wireless network, in the WIFI: format understood by
+// phone cameras
+type WiFiPayload struct {
+	SSID string `json:"ssid"`
+	// Security is WPA (also covering WPA2/WPA3), WEP or nopass
+	Security string `json:"security,omitempty"`
+	Password string `json:"password,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty"`
+}
+
+func (w *WiFiPayload) Encode() (string, error) {
+	if err := required("ssid", w.SSID); err != nil {
+		return "", err
+	}
+	w.Security = strings.ToUpper(w.Security)
+	switch w.Security {
+	case "":
+		w.Security = "WPA"
+	case "NOPASS":
+		w.Security = "nopass"
+	case "WPA", "WEP":
+	default:
+		return "", fmt.Errorf("security must be WPA, WEP or nopass")
+	}
+	if w.Security == "nopass" {
+		w.Password = ""
+	} else if w.Password == "" {
+		return "", fmt.Errorf("password is required for %s networks", w.Security)
+	}
+
+	var b strings.Builder
+	b.WriteString("WIFI:T:" + w.Security + ";S:" + wifiText(w.SSID) + ";")
+	if w.Password != "" {
+		b.WriteString("P:" + wifiText(w.Password) + ";")
+	}
+	if w.Hidden {
+		b.WriteString("H:true;")
+	}
+	b.WriteString(";")
+	return b.String(), nil
+}
+
+// wifiText escapes the characters with a meaning in the WIFI: format
+func wifiText(value string) string {
+	return escape(value, `\;,:"`)
+}
@@ -0,0 +1,188 @@
+// Package rollups keeps daily scan counts per QR code, split by the
+// dimensions analytics break scans down by. Counts are added as scans are
+// recorded, and Backfill and Rebuild compute them from the stored scans.
+//
+// Days are UTC days, like the daily salt of visitor hashes, so a scan is
+// unique when it is the first of its visitor on the code that day.
+package rollups
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Total is the dimension counting every scan, under an empty value
+const Total = "total"
+
+// countedEvents are the event types analytics count as scans: redirects
+// and contact page views. vCard downloads and refused attempts are only
+// logged.
+const countedEvents = "('redirect', 'page_view')"
+
+// Counted is the condition selecting the scans analytics count, on
+// qr_scans
+const Counted = "event_type IN " + countedEvents
+
+// dimension is a rollup dimension and the SQL giving a scan's value for
+// it, on qr_scans aliased s
+type dimension struct {
+	name, value string
+}
+
+var dimensions = []dimension{
+	{Total, "''"},
+	{"country", "COALESCE(NULLIF(s.country, ''), 'Unknown')"},
+	{"city", "COALESCE(NULLIF(s.city, ''), 'Unknown')"},
+	{"device_type", "COALESCE(NULLIF(s.device_type, ''), 'Unknown')"},
+	{"browser", "COALESCE(NULLIF(s.browser, ''), 'Unknown')"},
+	{"os", "COALESCE(NULLIF(s.os, ''), 'Unknown')"},
+	{"referrer", "COALESCE(NULLIF(s.referrer, ''), 'Direct')"},
+	{"hour", "strftime('%H', s.scanned_at)"},
+}
+
+// FirstVisit is 1 for the first counted scan of a visitor on a code in a
+// day, on qr_scans aliased s. Summing it gives unique scans as the rollups
+// count them.
+const FirstVisit = `CASE WHEN s.visitor_hash IS NOT NULL AND NOT EXISTS (
+	SELECT 1 FROM qr_scans p WHERE p.qr_code_id = s.qr_code_id AND p.visitor_hash = s.visitor_hash
+	AND p.scanned_at >= DATE(s.scanned_at) AND p.id < s.id AND p.event_type IN ` + countedEvents + `) THEN 1 ELSE 0 END`
+
+// counted selects the counted scans on qr_scans aliased s
+const counted = "s.event_type IN " + countedEvents
+
+const upsert = ` ON CONFLICT (qr_code_id, day, dimension, value)
+	DO UPDATE SET scans = scans + excluded.scans, unique_scans = unique_scans + excluded.unique_scans`
+
+// dimensionSelects selects the rollup rows of each dimension from the
+// scans of s, one row per scan or, if grouped, per code, day and value
+func dimensionSelects(grouped bool) string {
+	selects := make([]string, len(dimensions))
+	for i, d := range dimensions {
+		if grouped {
+			selects[i] = fmt.Sprintf(`SELECT s.qr_code_id, DATE(s.scanned_at), '%s', %s, COUNT(*), SUM(s.first_visit)
+				FROM scans s WHERE true GROUP BY 1, 2, 4`, d.name, d.value)
+		} else {
+			selects[i] = fmt.Sprintf(`SELECT s.qr_code_id, DATE(s.scanned_at), '%s', %s, 1, s.first_visit
+				FROM scans s WHERE true`, d.name, d.value)
+		}
+	}
+	return strings.Join(selects, " UNION ALL ")
+}
+
+var recordQuery = `WITH scans AS (SELECT s.*, ` + FirstVisit + ` AS first_visit FROM qr_scans s WHERE s.id = ? AND ` + counted + `)
+	INSERT INTO scan_rollups (qr_code_id, day, dimension, value, scans, unique_scans) ` +
+	dimensionSelects(false) + upsert
+
+// Execer is implemented by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record adds a newly stored scan to the rollups, if it is counted. It
+// should run in the transaction storing the scan, so Backfill never finds
+// a scan without its counts or counts it twice.
+func Record(db Execer, scanID int64) error {
+	_, err := db.Exec(recordQuery, scanID)
+	return err
+}
+
+// Counts is a subquery of the daily counts of every code for a dimension,
+// with columns qr_code_id, day, value, scans and unique_scans. Days before
+// today come from the rollups and today from the scans themselves, so
+// today's counts are exact even while scans are deleted. It panics on an
+// unknown dimension.
+func Counts(name string) string {
+	for _, d := range dimensions {
+		if d.name == name {
+			return `(SELECT qr_code_id, day, value, scans, unique_scans FROM scan_rollups
+				WHERE dimension = '` + d.name + `' AND day < DATE('now')
+				UNION ALL
+				SELECT s.qr_code_id, DATE(s.scanned_at), ` + d.value + `, 1, ` + FirstVisit + `
+				FROM qr_scans s WHERE s.scanned_at >= DATE('now') AND ` + counted + `)`
+		}
+	}
+	panic("rollups: unknown dimension " + name)
+}
+
+// compute adds the rollups of the counted scans matching condition, on
+// qr_scans aliased s
+func compute(tx *sql.Tx, condition string, args ...interface{}) error {
+	query := `WITH scans AS (SELECT s.*, ` + FirstVisit + ` AS first_visit FROM qr_scans s
+		WHERE ` + counted + ` AND ` + condition + `)
+		INSERT INTO scan_rollups (qr_code_id, day, dimension, value, scans, unique_scans) ` +
+		dimensionSelects(true) + upsert
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// Rebuild recomputes the rollups of every day from since, a YYYY-MM-DD
+// date, or of all days if since is empty. Counts of scans deleted since
+// they were recorded are dropped.
+func Rebuild(db *sql.DB, since string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM scan_rollups WHERE day >= ?", since); err != nil {
+		return err
+	}
+	if err := compute(tx, "s.scanned_at >= ?", since); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Backfill computes the rollups of days that count fewer scans than are
+// stored, such as days recorded before rollups existed, and returns how
+// many code days it recomputed. Days counting more scans than are left
+// keep their counts: scans deleted by retention or purges stay counted.
+func Backfill(db *sql.DB) (int, error) {
+	rows, err := db.Query(`SELECT s.qr_code_id, DATE(s.scanned_at) AS day FROM qr_scans s
+		WHERE ` + counted + `
+		GROUP BY s.qr_code_id, day
+		HAVING COUNT(*) > COALESCE((SELECT r.scans FROM scan_rollups r
+			WHERE r.qr_code_id = s.qr_code_id AND r.day = DATE(s.scanned_at) AND r.dimension = 'total'), 0)`)
+	if err != nil {
+		return 0, err
+	}
+	type codeDay struct {
+		qrID int
+		day  string
+	}
+	var missing []codeDay
+	for rows.Next() {
+		var missed codeDay
+		if err := rows.Scan(&missed.qrID, &missed.day); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		missing = append(missing, missed)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, missed := range missing {
+		tx, err := db.Begin()
+		if err != nil {
+			return i, err
+		}
+		_, err = tx.Exec("DELETE FROM scan_rollups WHERE qr_code_id = ? AND day = ?", missed.qrID, missed.day)
+		if err == nil {
+			err = compute(tx, "s.qr_code_id = ? AND s.scanned_at >= DATE(?) AND s.scanned_at < DATE(?, '+1 day')",
+				missed.qrID, missed.day, missed.day)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return i, err
+		}
+	}
+	return len(missing), nil
+}
@@ -0,0 +1,92 @@
+package rollups
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/GridexX/qr-tracker/internal/database"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	db, err := database.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// insertScan stores a scan, recording it in the same transaction if record
+// is set
+func insertScan(t *testing.T, db *sql.DB, scannedAt, visitor, eventType string, record bool) {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("INSERT INTO qr_scans (qr_code_id, visitor_hash, event_type, scanned_at) VALUES (1, ?, ?, ?)",
+		visitor, eventType, scannedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record {
+		id, _ := result.LastInsertId()
+		if err := Record(tx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func totals(t *testing.T, db *sql.DB, day string) (scans, unique int) {
+	t.Helper()
+	db.QueryRow("SELECT COALESCE(SUM(scans), 0), COALESCE(SUM(unique_scans), 0) FROM scan_rollups WHERE dimension = ? AND day = ?",
+		Total, day).Scan(&scans, &unique)
+	return scans, unique
+}
+
+func TestBackfillCountsScansOnce(t *testing.T) {
+	db := openTestDB(t)
+
+	// Recorded scans, one of them not counted
+	insertScan(t, db, "2026-01-05 10:00:00", "v1", "redirect", true)
+	insertScan(t, db, "2026-01-05 11:00:00", "v1", "vcard_download", true)
+	// Scans stored without their rollups, on a recorded day and a new one
+	insertScan(t, db, "2026-01-05 12:00:00", "v2", "page_view", false)
+	insertScan(t, db, "2026-01-06 09:00:00", "v1", "redirect", false)
+	insertScan(t, db, "2026-01-06 09:30:00", "v1", "redirect", false)
+
+	if scans, unique := totals(t, db, "2026-01-05"); scans != 1 || unique != 1 {
+		t.Fatalf("recorded %d scans, %d unique, want 1 and 1", scans, unique)
+	}
+
+	days, err := Backfill(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days != 2 {
+		t.Errorf("%d code days backfilled, want 2", days)
+	}
+	for _, tc := range []struct {
+		day                   string
+		wantScans, wantUnique int
+	}{
+		{"2026-01-05", 2, 2},
+		{"2026-01-06", 2, 1},
+	} {
+		if scans, unique := totals(t, db, tc.day); scans != tc.wantScans || unique != tc.wantUnique {
+			t.Errorf("%s: %d scans, %d unique, want %d and %d", tc.day, scans, unique, tc.wantScans, tc.wantUnique)
+		}
+	}
+
+	// A second run finds nothing left to do
+	if days, err := Backfill(db); err != nil || days != 0 {
+		t.Errorf("second backfill: %d code days, %v", days, err)
+	}
+}
@@ -0,0 +1,117 @@
+package safety
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checker looks target URLs up in a blocklist
+type Checker interface {
+	Name() string
+	Blocked(target *url.URL) (bool, error)
+}
+
+// FileChecker is an offline blocklist read from a local file. Each line is
+// a domain, which also blocks its subdomains, or a URL prefix starting with
+// a scheme; blank lines and lines starting with # are ignored. Prefixes are
+// matched regardless of scheme and host case and of default ports. The file
+// is reloaded when it changes.
+type FileChecker struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	domains  []string
+	prefixes []string
+}
+
+func NewFileChecker(path string) *FileChecker {
+	return &FileChecker{path: path}
+}
+
+func (f *FileChecker) Name() string { return "file:" + f.path }
+
+func (f *FileChecker) Blocked(target *url.URL) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return false, err
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if matchesDomain(host, f.domains) {
+		return true, nil
+	}
+	raw := normalizeURL(target)
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(raw, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reload rereads the list if the file changed since it was last read
+func (f *FileChecker) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var domains, prefixes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.Contains(line, "://"):
+			if prefix, err := url.Parse(line); err == nil {
+				prefixes = append(prefixes, normalizeURL(prefix))
+			}
+		default:
+			domains = append(domains, strings.TrimSuffix(strings.ToLower(line), "."))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	f.domains, f.prefixes, f.modTime = domains, prefixes, info.ModTime()
+	return nil
+}
+
+// defaultPorts are left out of normalized URLs
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// normalizeURL returns u with a lowercase scheme and host, without a
+// trailing dot on the host or a default port, and with at least a / path
+func normalizeURL(u *url.URL) string {
+	normalized := *u
+	normalized.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[normalized.Scheme] {
+		host += ":" + port
+	}
+	normalized.Host = host
+	if normalized.Path == "" && normalized.Opaque == "" {
+		normalized.Path = "/"
+	}
+	return normalized.String()
+}
@@ -0,0 +1,101 @@
+package safety
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeList(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileChecker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeList(t, path, `# phishing
+Evil.example.
+https://Files.Example.com/malware
+http://example.org
+`, time.Now().Add(-time.Hour))
+	checker := NewFileChecker(path)
+
+	for _, tc := range []struct {
+		target  string
+		blocked bool
+	}{
+		{"https://evil.example/login", true},
+		{"https://www.EVIL.example./login", true},
+		{"https://notevil.example/", false},
+		{"https://files.example.com/malware/payload.exe", true},
+		{"HTTPS://FILES.EXAMPLE.COM/malware", true},
+		{"https://files.example.com:443/malware", true},
+		{"https://files.example.com./malware", true},
+		{"https://files.example.com:8443/malware", false},
+		{"https://files.example.com/Malware", false},
+		{"http://files.example.com/malware", false},
+		{"http://example.org", true},
+		{"http://example.org:80/page", true},
+		{"http://example.org.attacker.net/", false},
+		{"https://example.org/", false},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			u, err := url.Parse(tc.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocked, err := checker.Blocked(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blocked != tc.blocked {
+				t.Errorf("blocked = %v, want %v", blocked, tc.blocked)
+			}
+		})
+	}
+}
+
+func TestFileCheckerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	start := time.Now().Add(-time.Hour)
+	writeList(t, path, "first.example\n", start)
+	checker := NewFileChecker(path)
+	first, _ := url.Parse("https://first.example/")
+	second, _ := url.Parse("https://SECOND.example:443/path")
+
+	for _, step := range []struct {
+		name          string
+		content       string
+		modTime       time.Time
+		first, second bool
+	}{
+		{"initial list", "", time.Time{}, true, false},
+		{"changed file", "https://second.example/\n", start.Add(time.Minute), false, true},
+		{"unchanged modification time", "first.example\n", start.Add(time.Minute), false, true},
+		{"emptied file", "", start.Add(2 * time.Minute), false, false},
+	} {
+		if !step.modTime.IsZero() {
+			writeList(t, path, step.content, step.modTime)
+		}
+		for _, target := range []struct {
+			u    *url.URL
+			want bool
+		}{{first, step.first}, {second, step.second}} {
+			if blocked, err := checker.Blocked(target.u); err != nil || blocked != target.want {
+				t.Errorf("%s: %s blocked = %v, %v, want %v", step.name, target.u, blocked, err, target.want)
+			}
+		}
+	}
+
+	os.Remove(path)
+	if _, err := checker.Blocked(first); err == nil {
+		t.Error("missing file: no error")
+	}
+}
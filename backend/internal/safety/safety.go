@@ -0,0 +1,142 @@
+package safety
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// defaultSchemes are the target URL schemes allowed unless
+// TARGET_URL_SCHEMES says otherwise
+const defaultSchemes = "http,https"
+
+// Policy decides which URLs QR codes may redirect to
+type Policy struct {
+	// Schemes allowed in target URLs
+	Schemes []string
+	// Allow, if not empty, lists the only domains targets may point to
+	Allow []string
+	// Deny lists domains targets may not point to
+	Deny []string
+	// Checkers look targets up in blocklists
+	Checkers []Checker
+}
+
+// FromEnv builds the policy configured by TARGET_URL_SCHEMES,
+// TARGET_DOMAIN_ALLOWLIST, TARGET_DOMAIN_DENYLIST and URL_BLOCKLIST_FILE
+func FromEnv() *Policy {
+	schemes := os.Getenv("TARGET_URL_SCHEMES")
+	if schemes == "" {
+		schemes = defaultSchemes
+	}
+	policy := &Policy{
+		Schemes: splitList(schemes),
+		Allow:   splitList(os.Getenv("TARGET_DOMAIN_ALLOWLIST")),
+		Deny:    splitList(os.Getenv("TARGET_DOMAIN_DENYLIST")),
+	}
+	if path := os.Getenv("URL_BLOCKLIST_FILE"); path != "" {
+		policy.Checkers = append(policy.Checkers, NewFileChecker(path))
+	}
+
+	log.Printf("Target URL schemes: %s", strings.Join(policy.Schemes, ", "))
+	return policy
+}
+
+// Check returns an error describing why target may not be redirected to,
+// or nil if it is allowed. Blocklists that can't be consulted are logged
+// and skipped.
+func (p *Policy) Check(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !contains(p.Schemes, scheme) {
+		if scheme == "" {
+			return fmt.Errorf("URL must be absolute, with one of the schemes %s", strings.Join(p.Schemes, ", "))
+		}
+		return fmt.Errorf("URL scheme %q is not allowed", scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("URL must not contain credentials")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if !validHost(host) {
+		return fmt.Errorf("URL host %q is not a valid hostname", u.Host)
+	}
+	if len(p.Allow) > 0 && !matchesDomain(host, p.Allow) {
+		return fmt.Errorf("domain %s is not on the allowlist", host)
+	}
+	if matchesDomain(host, p.Deny) {
+		return fmt.Errorf("domain %s is denied", host)
+	}
+
+	for _, checker := range p.Checkers {
+		blocked, err := checker.Blocked(u)
+		if err != nil {
+			log.Printf("Blocklist %s unavailable: %v", checker.Name(), err)
+			continue
+		}
+		if blocked {
+			return fmt.Errorf("URL is blocklisted by %s", checker.Name())
+		}
+	}
+	return nil
+}
+
+// validHost reports whether host is an IP address or a domain name made of
+// valid labels
+func validHost(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesDomain reports whether host is one of domains or a subdomain of one
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
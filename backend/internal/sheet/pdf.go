@@ -0,0 +1,104 @@
+package sheet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// pdfWriter writes the objects of a PDF file as they come, remembering
+// only their offsets for the cross-reference table
+type pdfWriter struct {
+	w       io.Writer
+	offset  int64
+	offsets map[int]int64
+	nextID  int
+	err     error
+}
+
+func newPDFWriter(w io.Writer, reserved int) *pdfWriter {
+	return &pdfWriter{w: w, offsets: map[int]int64{}, nextID: reserved + 1}
+}
+
+// header starts the file. The binary comment marks it as binary for
+// transfer tools.
+func (p *pdfWriter) header() {
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (p *pdfWriter) write(data []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// newID allocates the number of an object written later
+func (p *pdfWriter) newID() int {
+	id := p.nextID
+	p.nextID++
+	return id
+}
+
+// object writes object id with the given dictionary or value
+func (p *pdfWriter) object(id int, body string) {
+	p.offsets[id] = p.offset
+	p.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream writes object id as a Flate compressed stream
+func (p *pdfWriter) stream(id int, data []byte) {
+	var compressed bytes.Buffer
+	z := zlib.NewWriter(&compressed)
+	z.Write(data)
+	z.Close()
+
+	p.offsets[id] = p.offset
+	p.printf("%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", id, compressed.Len())
+	p.write(compressed.Bytes())
+	p.printf("\nendstream\nendobj\n")
+}
+
+// finish writes the cross-reference table and trailer
+func (p *pdfWriter) finish(root int) error {
+	xref := p.offset
+	size := p.nextID
+	p.printf("xref\n0 %d\n0000000000 65535 f\r\n", size)
+	for id := 1; id < size; id++ {
+		p.printf("%010d 00000 n\r\n", p.offsets[id])
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, root, xref)
+	return p.err
+}
+
+// pdfText encodes s as a PDF string in WinAnsiEncoding. Characters outside
+// Latin-1 are replaced with '?'.
+func pdfText(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
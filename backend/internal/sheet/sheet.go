@@ -0,0 +1,243 @@
+// Package sheet lays QR codes out on printable PDF label sheets. Pages are
+// written as soon as they are full, so sheets of any length are streamed.
+package sheet
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Page sizes in points
+var PageSizes = map[string][2]float64{
+	"a4":     {595.28, 841.89},
+	"letter": {612, 792},
+}
+
+// Layout is the grid of labels on each page. Lengths are in millimeters.
+type Layout struct {
+	PageSize  string
+	Columns   int
+	Rows      int
+	Margin    float64
+	Gap       float64
+	Captions  bool
+	CropMarks bool
+}
+
+// Label is one QR code on the sheet
+type Label struct {
+	// Bitmap holds the modules of the code, quiet zone included
+	Bitmap     [][]bool
+	Foreground color.Color
+	Background color.Color
+	Caption    string
+}
+
+const (
+	pointsPerMM    = 72 / 25.4
+	cropMarkLength = 4 * pointsPerMM
+	cropMarkOffset = 1 * pointsPerMM
+	minLabelSide   = 10 * pointsPerMM
+)
+
+// Reserved object numbers
+const (
+	catalogID = 1
+	pagesID   = 2
+	fontID    = 3
+)
+
+// Writer writes labels to a PDF label sheet
+type Writer struct {
+	pdf    *pdfWriter
+	layout Layout
+
+	pageWidth, pageHeight float64
+	cellWidth, cellHeight float64
+	margin, gap           float64
+
+	started bool
+	pages   []int
+	content bytes.Buffer
+	slot    int
+}
+
+// NewWriter prepares a label sheet written to w. It fails if the grid
+// leaves too little room for the codes, before anything is written.
+func NewWriter(w io.Writer, layout Layout) (*Writer, error) {
+	size, ok := PageSizes[layout.PageSize]
+	if !ok {
+		return nil, fmt.Errorf("unknown page size %q", layout.PageSize)
+	}
+	if layout.Columns < 1 || layout.Rows < 1 {
+		return nil, fmt.Errorf("the grid needs at least one column and one row")
+	}
+
+	s := &Writer{
+		layout:     layout,
+		pageWidth:  size[0],
+		pageHeight: size[1],
+		margin:     layout.Margin * pointsPerMM,
+		gap:        layout.Gap * pointsPerMM,
+	}
+	s.cellWidth = (s.pageWidth - 2*s.margin - float64(layout.Columns-1)*s.gap) / float64(layout.Columns)
+	s.cellHeight = (s.pageHeight - 2*s.margin - float64(layout.Rows-1)*s.gap) / float64(layout.Rows)
+	if side, _, _ := s.labelBox(); side < minLabelSide {
+		return nil, fmt.Errorf("the grid leaves less than 10mm for each code")
+	}
+
+	s.pdf = newPDFWriter(w, fontID)
+	return s, nil
+}
+
+// start writes the beginning of the file on first use
+func (s *Writer) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.pdf.header()
+	s.pdf.object(fontID, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+}
+
+// Add places a label in the next free cell, starting a new page when the
+// current one is full
+func (s *Writer) Add(label Label) error {
+	s.start()
+	if s.slot == s.layout.Columns*s.layout.Rows {
+		s.flushPage()
+	}
+
+	col := s.slot % s.layout.Columns
+	row := s.slot / s.layout.Columns
+	x := s.margin + float64(col)*(s.cellWidth+s.gap)
+	y := s.pageHeight - s.margin - float64(row)*(s.cellHeight+s.gap) - s.cellHeight
+	s.slot++
+
+	s.drawCode(label, x, y)
+	if s.layout.Captions && label.Caption != "" {
+		s.drawCaption(label.Caption, x, y)
+	}
+	if s.layout.CropMarks {
+		s.drawCropMarks(x, y)
+	}
+	return s.pdf.err
+}
+
+// Close writes the last page and the end of the file
+func (s *Writer) Close() error {
+	s.start()
+	if s.slot > 0 || len(s.pages) == 0 {
+		s.flushPage()
+	}
+
+	kids := make([]string, len(s.pages))
+	for i, id := range s.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	s.pdf.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(s.pages)))
+	s.pdf.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+	return s.pdf.finish(catalogID)
+}
+
+func (s *Writer) flushPage() {
+	contentID := s.pdf.newID()
+	pageID := s.pdf.newID()
+	s.pdf.stream(contentID, s.content.Bytes())
+	s.pdf.object(pageID, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+		pagesID, s.pageWidth, s.pageHeight, fontID, contentID))
+	s.pages = append(s.pages, pageID)
+	s.content.Reset()
+	s.slot = 0
+}
+
+// labelBox returns the side of the codes, the padding around them and the
+// font size of their captions
+func (s *Writer) labelBox() (side, padding, fontSize float64) {
+	padding = min(s.cellWidth, s.cellHeight) * 0.05
+	captionHeight := 0.0
+	if s.layout.Captions {
+		fontSize = max(6, min(10, s.cellHeight*0.08))
+		captionHeight = fontSize * 1.5
+	}
+	side = min(s.cellWidth-2*padding, s.cellHeight-2*padding-captionHeight)
+	return side, padding, fontSize
+}
+
+// drawCode draws the modules of a code in the cell at x, y, merging runs
+// of dark modules into single rectangles
+func (s *Writer) drawCode(label Label, x, y float64) {
+	side, padding, fontSize := s.labelBox()
+	captionHeight := 0.0
+	if s.layout.Captions {
+		captionHeight = fontSize * 1.5
+	}
+	left := x + (s.cellWidth-side)/2
+	bottom := y + padding + captionHeight + (s.cellHeight-2*padding-captionHeight-side)/2
+	modules := len(label.Bitmap)
+	if modules == 0 {
+		return
+	}
+	unit := side / float64(modules)
+
+	fmt.Fprintf(&s.content, "%s rg %.3f %.3f %.3f %.3f re f\n", rgb(label.Background, 1), left, bottom, side, side)
+	fmt.Fprintf(&s.content, "%s rg\n", rgb(label.Foreground, 0))
+	for r, row := range label.Bitmap {
+		top := bottom + side - float64(r+1)*unit
+		for c := 0; c < len(row); {
+			if !row[c] {
+				c++
+				continue
+			}
+			start := c
+			for c < len(row) && row[c] {
+				c++
+			}
+			fmt.Fprintf(&s.content, "%.3f %.3f %.3f %.3f re\n", left+float64(start)*unit, top, float64(c-start)*unit, unit)
+		}
+	}
+	s.content.WriteString("f\n")
+}
+
+// drawCaption centers a caption under the code, shortened to fit the cell.
+// Widths are estimated from the average Helvetica character width.
+func (s *Writer) drawCaption(caption string, x, y float64) {
+	_, padding, fontSize := s.labelBox()
+	charWidth := fontSize * 0.55
+	maxChars := int((s.cellWidth - 2*padding) / charWidth)
+	if utf8.RuneCountInString(caption) > maxChars {
+		runes := []rune(caption)
+		caption = string(runes[:max(0, maxChars-3)]) + "..."
+	}
+	width := float64(utf8.RuneCountInString(caption)) * charWidth
+	fmt.Fprintf(&s.content, "0 g BT /F1 %.2f Tf %.3f %.3f Td %s Tj ET\n",
+		fontSize, x+(s.cellWidth-width)/2, y+padding+fontSize*0.4, pdfText(caption))
+}
+
+// drawCropMarks draws cut lines just outside the corners of a cell
+func (s *Writer) drawCropMarks(x, y float64) {
+	s.content.WriteString("0.5 G 0.3 w\n")
+	right, top := x+s.cellWidth, y+s.cellHeight
+	for _, corner := range [][4]float64{{x, y, -1, -1}, {right, y, 1, -1}, {x, top, -1, 1}, {right, top, 1, 1}} {
+		cx, cy, dx, dy := corner[0], corner[1], corner[2], corner[3]
+		fmt.Fprintf(&s.content, "%.3f %.3f m %.3f %.3f l S\n",
+			cx+dx*cropMarkOffset, cy, cx+dx*(cropMarkOffset+cropMarkLength), cy)
+		fmt.Fprintf(&s.content, "%.3f %.3f m %.3f %.3f l S\n",
+			cx, cy+dy*cropMarkOffset, cx, cy+dy*(cropMarkOffset+cropMarkLength))
+	}
+}
+
+// rgb formats a color as PDF color operands, using gray level fallback
+// for a nil color
+func rgb(c color.Color, fallback float64) string {
+	if c == nil {
+		return fmt.Sprintf("%.3f %.3f %.3f", fallback, fallback, fallback)
+	}
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+}
@@ -0,0 +1,167 @@
+package sheet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pdfObjects checks the cross-reference table of a PDF file, whose every
+// entry must point at the start of its object, and returns the objects by
+// number
+func pdfObjects(t *testing.T, file []byte) map[int]string {
+	t.Helper()
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(file)
+	if match == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	table := string(file[xref:])
+	if !strings.HasPrefix(table, "xref\n0 ") {
+		t.Fatalf("startxref %d doesn't point at the xref table", xref)
+	}
+	lines := strings.Split(table, "\n")
+	size, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	if !regexp.MustCompile(`/Size ` + strconv.Itoa(size) + ` /Root 1 0 R`).MatchString(table) {
+		t.Errorf("trailer doesn't match the xref size %d", size)
+	}
+
+	objects := map[int]string{}
+	for id := 1; id < size; id++ {
+		entry := strings.TrimSuffix(lines[2+id], "\r")
+		if len(entry) != 18 || !strings.HasSuffix(entry, " 00000 n") {
+			t.Fatalf("xref entry %d is %q", id, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		header := fmt.Sprintf("%d 0 obj\n", id)
+		if !bytes.HasPrefix(file[offset:], []byte(header)) {
+			t.Fatalf("xref entry %d points at %q", id, file[offset:min(len(file), offset+20)])
+		}
+		end := bytes.Index(file[offset:], []byte("\nendobj\n"))
+		objects[id] = string(file[offset+len(header) : offset+end])
+	}
+	return objects
+}
+
+// pageContents returns the decompressed content streams of the pages of a
+// sheet, in order
+func pageContents(t *testing.T, objects map[int]string) []string {
+	t.Helper()
+	kids := regexp.MustCompile(`/Kids \[([^\]]*)\] /Count (\d+)`).FindStringSubmatch(objects[pagesID])
+	if kids == nil {
+		t.Fatalf("pages object %q", objects[pagesID])
+	}
+	refs := regexp.MustCompile(`(\d+) 0 R`).FindAllStringSubmatch(kids[1], -1)
+	if count, _ := strconv.Atoi(kids[2]); count != len(refs) {
+		t.Errorf("/Count %d for %d kids", count, len(refs))
+	}
+
+	var contents []string
+	for _, ref := range refs {
+		id, _ := strconv.Atoi(ref[1])
+		page := objects[id]
+		if !strings.Contains(page, "/Type /Page ") || !strings.Contains(page, fmt.Sprintf("/Parent %d 0 R", pagesID)) {
+			t.Fatalf("page object %d is %q", id, page)
+		}
+		contentID, _ := strconv.Atoi(regexp.MustCompile(`/Contents (\d+) 0 R`).FindStringSubmatch(page)[1])
+		stream := objects[contentID]
+		length, _ := strconv.Atoi(regexp.MustCompile(`/Length (\d+)`).FindStringSubmatch(stream)[1])
+		start := strings.Index(stream, "stream\n") + len("stream\n")
+		if !strings.HasPrefix(stream[start+length:], "\nendstream") {
+			t.Fatalf("stream %d has the wrong /Length", contentID)
+		}
+		z, err := zlib.NewReader(strings.NewReader(stream[start : start+length]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(z)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(content))
+	}
+	return contents
+}
+
+func testLabel(caption string) Label {
+	bitmap := make([][]bool, 21)
+	for i := range bitmap {
+		bitmap[i] = make([]bool, 21)
+		bitmap[i][i] = true
+	}
+	return Label{Bitmap: bitmap, Foreground: color.RGBA{R: 0x11, A: 0xff}, Caption: caption}
+}
+
+func TestWriterPages(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		layout    Layout
+		labels    int
+		wantPages int
+	}{
+		{"no labels", Layout{PageSize: "a4", Columns: 3, Rows: 4}, 0, 1},
+		{"one full page", Layout{PageSize: "a4", Columns: 3, Rows: 4, Captions: true}, 12, 1},
+		{"one more label", Layout{PageSize: "letter", Columns: 3, Rows: 4, CropMarks: true}, 13, 2},
+		{"small grid", Layout{PageSize: "a4", Columns: 2, Rows: 2, Margin: 10, Gap: 5, Captions: true, CropMarks: true}, 25, 7},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var file bytes.Buffer
+			w, err := NewWriter(&file, tc.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.labels; i++ {
+				if err := w.Add(testLabel(fmt.Sprintf("Table (%d)", i+1))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(file.Bytes(), []byte("%PDF-1.4\n")) {
+				t.Errorf("missing header")
+			}
+
+			contents := pageContents(t, pdfObjects(t, file.Bytes()))
+			if len(contents) != tc.wantPages {
+				t.Fatalf("%d pages, want %d", len(contents), tc.wantPages)
+			}
+			codes, captions := 0, 0
+			for _, content := range contents {
+				codes += strings.Count(content, "0.067 0.000 0.000 rg\n")
+				captions += strings.Count(content, " Tj ET")
+			}
+			if codes != tc.labels {
+				t.Errorf("%d codes drawn, want %d", codes, tc.labels)
+			}
+			if wantCaptions := map[bool]int{true: tc.labels}[tc.layout.Captions]; captions != wantCaptions {
+				t.Errorf("%d captions drawn, want %d", captions, wantCaptions)
+			}
+			if tc.labels > 0 && tc.layout.Captions && !strings.Contains(contents[0], `(Table \(1\)) Tj`) {
+				t.Errorf("caption not escaped in %q", contents[0])
+			}
+		})
+	}
+}
+
+func TestNewWriterRejectsLayouts(t *testing.T) {
+	for _, layout := range []Layout{
+		{PageSize: "a3", Columns: 3, Rows: 4},
+		{PageSize: "a4", Columns: 0, Rows: 4},
+		{PageSize: "a4", Columns: 20, Rows: 30, Margin: 10, Gap: 5},
+	} {
+		var file bytes.Buffer
+		if _, err := NewWriter(&file, layout); err == nil {
+			t.Errorf("layout %+v was accepted", layout)
+		}
+		if file.Len() > 0 {
+			t.Errorf("layout %+v: %d bytes written", layout, file.Len())
+		}
+	}
+}
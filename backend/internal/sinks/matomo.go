@@ -0,0 +1,53 @@
+package sinks
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// Matomo records scans as events through the Matomo HTTP tracking API
+type Matomo struct {
+	Endpoint  string
+	SiteID    string
+	AuthToken string
+}
+
+func matomoFromEnv() Sink {
+	endpoint, site := os.Getenv("MATOMO_URL"), os.Getenv("MATOMO_SITE_ID")
+	if endpoint == "" || site == "" {
+		return nil
+	}
+	return &Matomo{Endpoint: endpoint, SiteID: site, AuthToken: os.Getenv("MATOMO_TOKEN")}
+}
+
+func (s *Matomo) Name() string { return "matomo" }
+
+func (s *Matomo) Send(ctx context.Context, e Event) error {
+	form := url.Values{
+		"idsite":      {s.SiteID},
+		"rec":         {"1"},
+		"apiv":        {"1"},
+		"url":         {e.ScanURL},
+		"action_name": {"QR code " + e.Code},
+		"e_c":         {"QR Code"},
+		"e_a":         {e.Name},
+		"e_n":         {e.Code},
+		"e_v":         {strconv.Itoa(e.QRCodeID)},
+		"ua":          {e.UserAgent},
+		"cdt":         {strconv.FormatInt(e.Time.Unix(), 10)},
+	}
+	// Matomo visitor IDs are exactly 16 hex characters
+	if len(e.VisitorID) >= 16 {
+		form.Set("_id", e.VisitorID[:16])
+	}
+	// Overriding the client IP requires an auth token
+	if s.AuthToken != "" {
+		form.Set("token_auth", s.AuthToken)
+		if ip := e.clientIP(); ip != "" {
+			form.Set("cip", ip)
+		}
+	}
+	return post(ctx, s.Endpoint+"/matomo.php", "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+}
@@ -0,0 +1,34 @@
+package sinks
+
+import (
+	"context"
+	"os"
+)
+
+// Plausible sends custom events to the Plausible events API
+type Plausible struct {
+	Endpoint string
+	Domain   string
+}
+
+func plausibleFromEnv() Sink {
+	domain := os.Getenv("PLAUSIBLE_DOMAIN")
+	if domain == "" {
+		return nil
+	}
+	return &Plausible{Endpoint: envOr("PLAUSIBLE_URL", "https://plausible.io"), Domain: domain}
+}
+
+func (s *Plausible) Name() string { return "plausible" }
+
+func (s *Plausible) Send(ctx context.Context, e Event) error {
+	payload := map[string]interface{}{
+		"name":   e.Name,
+		"url":    e.ScanURL,
+		"domain": s.Domain,
+		"props":  e.params(),
+	}
+	// Plausible derives unique visitors and location from these headers
+	headers := map[string]string{"User-Agent": e.UserAgent, "X-Forwarded-For": e.clientIP()}
+	return postJSON(ctx, s.Endpoint+"/api/event", payload, headers)
+}
@@ -0,0 +1,198 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	queueSize   = 1000
+	workers     = 4
+	maxAttempts = 3
+	sendTimeout = 10 * time.Second
+)
+
+// retryBackoff is the wait before the first retry, doubled on each retry
+var retryBackoff = time.Second
+
+// Event is a QR code scan forwarded to the analytics sinks
+type Event struct {
+	Name       string    `json:"event"`
+	QRCodeID   int       `json:"qr_code_id"`
+	Code       string    `json:"qr_code"`
+	ScanURL    string    `json:"scan_url"`
+	TargetURL  string    `json:"target_url"`
+	VisitorID  string    `json:"visitor_id,omitempty"`
+	ClientIP   string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Browser    string    `json:"browser,omitempty"`
+	DeviceType string    `json:"device_type,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	City       string    `json:"city,omitempty"`
+	Time       time.Time `json:"timestamp"`
+}
+
+// Sink delivers scan events to an external analytics service
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event Event) error
+}
+
+type delivery struct {
+	sink  Sink
+	event Event
+}
+
+// Dispatcher delivers events to the configured sinks in the background,
+// retrying failed deliveries with exponential backoff
+type Dispatcher struct {
+	sinks []Sink
+	queue chan delivery
+}
+
+// NewDispatcher starts the delivery workers for the given sinks
+func NewDispatcher(sinks ...Sink) *Dispatcher {
+	d := &Dispatcher{sinks: sinks, queue: make(chan delivery, queueSize)}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// FromEnv builds a dispatcher for every sink configured in the environment
+func FromEnv() *Dispatcher {
+	var configured []Sink
+	for _, sink := range []Sink{ga4FromEnv(), plausibleFromEnv(), umamiFromEnv(), matomoFromEnv(), webhookFromEnv()} {
+		if sink != nil {
+			configured = append(configured, sink)
+		}
+	}
+
+	names := make([]string, len(configured))
+	for i, sink := range configured {
+		names[i] = sink.Name()
+	}
+	if len(names) > 0 {
+		log.Printf("Analytics sinks: %s", strings.Join(names, ", "))
+	}
+
+	return NewDispatcher(configured...)
+}
+
+// Dispatch queues an event for every sink whose name is in enabled. A nil
+// enabled list means all configured sinks. Events are dropped, not
+// blocked on, when the queue is full.
+func (d *Dispatcher) Dispatch(event Event, enabled []string) {
+	for _, sink := range d.sinks {
+		if enabled != nil && !contains(enabled, sink.Name()) {
+			continue
+		}
+		select {
+		case d.queue <- delivery{sink: sink, event: event}:
+		default:
+			log.Printf("Analytics queue full, dropping %s event for QR %s", sink.Name(), event.Code)
+		}
+	}
+}
+
+func (d *Dispatcher) work() {
+	for job := range d.queue {
+		backoff := retryBackoff
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			err := job.sink.Send(ctx, job.event)
+			cancel()
+			if err == nil {
+				break
+			}
+			if attempt == maxAttempts {
+				log.Printf("Error sending event to %s after %d attempts: %v", job.sink.Name(), attempt, err)
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+var client = &http.Client{Timeout: sendTimeout}
+
+// post sends body to url and treats any non-2xx response as an error
+func post(ctx context.Context, url, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, "application/json", body, headers)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// clientIP returns the client IP, or "" when it was stored as a hash and
+// can't be passed on as an address
+func (e Event) clientIP() string {
+	if net.ParseIP(e.ClientIP) == nil {
+		return ""
+	}
+	return e.ClientIP
+}
+
+// params returns the event properties shared by all sinks
+func (e Event) params() map[string]interface{} {
+	return map[string]interface{}{
+		"qr_code_id":  e.QRCodeID,
+		"qr_code":     e.Code,
+		"target_url":  e.TargetURL,
+		"device_type": e.DeviceType,
+		"browser":     e.Browser,
+		"country":     e.Country,
+	}
+}
@@ -0,0 +1,348 @@
+package sinks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request is what a stub server received
+type request struct {
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+}
+
+// stub is a local HTTP server standing in for an analytics service. It
+// answers with the queued statuses in order, then with 204.
+type stub struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received chan request
+}
+
+func newStub(t *testing.T, statuses ...int) *stub {
+	s := &stub{statuses: statuses, received: make(chan request, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.received <- request{path: r.URL.Path, query: r.URL.Query(), header: r.Header, body: body}
+
+		s.mu.Lock()
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// next waits for the next request the stub received
+func (s *stub) next(t *testing.T) request {
+	t.Helper()
+	select {
+	case r := <-s.received:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received")
+		return request{}
+	}
+}
+
+// none checks that the stub receives no further request
+func (s *stub) none(t *testing.T) {
+	t.Helper()
+	select {
+	case r := <-s.received:
+		t.Fatalf("unexpected request to %s", r.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+var testEvent = Event{
+	Name:       "qr_code_scan",
+	QRCodeID:   7,
+	Code:       "abc123",
+	ScanURL:    "https://qr.example.com/r/abc123",
+	TargetURL:  "https://example.com/landing",
+	VisitorID:  "0123456789abcdef0123456789abcdef",
+	ClientIP:   "203.0.113.0",
+	UserAgent:  "Mozilla/5.0 (iPhone)",
+	Browser:    "Safari",
+	DeviceType: "Mobile",
+	Country:    "France",
+	City:       "Paris",
+	Time:       time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+}
+
+func decode(t *testing.T, body []byte) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", body, err)
+	}
+	return payload
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	server := newStub(t)
+	sink := &Webhook{URL: server.URL + "/hook", Secret: "secret"}
+	if err := sink.Send(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	r := server.next(t)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(r.body)
+	if got, want := r.header.Get("X-QR-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	var event Event
+	if err := json.Unmarshal(r.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event != testEvent {
+		t.Errorf("event = %+v, want %+v", event, testEvent)
+	}
+}
+
+func TestWebhookWithoutSecretIsUnsigned(t *testing.T) {
+	server := newStub(t)
+	if err := (&Webhook{URL: server.URL}).Send(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if signature := server.next(t).header.Get("X-QR-Signature"); signature != "" {
+		t.Errorf("unexpected signature %q", signature)
+	}
+}
+
+func TestGA4Payload(t *testing.T) {
+	server := newStub(t)
+	sink := &GA4{Endpoint: server.URL, MeasurementID: "G-TEST", APISecret: "api-secret"}
+	if err := sink.Send(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	r := server.next(t)
+	if r.path != "/mp/collect" {
+		t.Errorf("path = %q", r.path)
+	}
+	if r.query.Get("measurement_id") != "G-TEST" || r.query.Get("api_secret") != "api-secret" {
+		t.Errorf("query = %v", r.query)
+	}
+	payload := decode(t, r.body)
+	if payload["client_id"] != testEvent.VisitorID {
+		t.Errorf("client_id = %v", payload["client_id"])
+	}
+	if payload["timestamp_micros"] != float64(testEvent.Time.UnixMicro()) {
+		t.Errorf("timestamp_micros = %v", payload["timestamp_micros"])
+	}
+	events := payload["events"].([]interface{})
+	event := events[0].(map[string]interface{})
+	params := event["params"].(map[string]interface{})
+	if len(events) != 1 || event["name"] != "qr_code_scan" || params["qr_code"] != "abc123" || params["qr_code_id"] != float64(7) {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func TestGA4AnonymousClientID(t *testing.T) {
+	server := newStub(t)
+	event := testEvent
+	event.VisitorID = ""
+	if err := (&GA4{Endpoint: server.URL}).Send(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if id := decode(t, server.next(t).body)["client_id"]; id != "anonymous" {
+		t.Errorf("client_id = %v", id)
+	}
+}
+
+// hashedIP is a client IP stored in the hash anonymization mode
+const hashedIP = "5d41402abc4b2a76b9719d911017c592"
+
+func TestPlausiblePayload(t *testing.T) {
+	for _, tc := range []struct {
+		name, clientIP, wantIP string
+	}{
+		{"truncated IP", testEvent.ClientIP, testEvent.ClientIP},
+		{"hashed IP", hashedIP, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newStub(t)
+			sink := &Plausible{Endpoint: server.URL, Domain: "qr.example.com"}
+			event := testEvent
+			event.ClientIP = tc.clientIP
+			if err := sink.Send(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+
+			r := server.next(t)
+			if r.path != "/api/event" {
+				t.Errorf("path = %q", r.path)
+			}
+			if r.header.Get("User-Agent") != testEvent.UserAgent || r.header.Get("X-Forwarded-For") != tc.wantIP {
+				t.Errorf("headers = %v", r.header)
+			}
+			payload := decode(t, r.body)
+			if payload["name"] != "qr_code_scan" || payload["url"] != testEvent.ScanURL || payload["domain"] != "qr.example.com" {
+				t.Errorf("payload = %v", payload)
+			}
+		})
+	}
+}
+
+func TestUmamiPayload(t *testing.T) {
+	server := newStub(t)
+	event := testEvent
+	event.UserAgent = ""
+	if err := (&Umami{Endpoint: server.URL, WebsiteID: "site"}).Send(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	r := server.next(t)
+	if r.path != "/api/send" {
+		t.Errorf("path = %q", r.path)
+	}
+	if ua := r.header.Get("User-Agent"); ua != "qr-tracker" {
+		t.Errorf("User-Agent = %q", ua)
+	}
+	payload := decode(t, r.body)["payload"].(map[string]interface{})
+	if payload["website"] != "site" || payload["hostname"] != "qr.example.com" || payload["url"] != "/r/abc123" || payload["name"] != "qr_code_scan" {
+		t.Errorf("payload = %v", payload)
+	}
+}
+
+func TestMatomoForm(t *testing.T) {
+	for _, tc := range []struct {
+		name, token, clientIP, wantIP string
+	}{
+		{"without token", "", testEvent.ClientIP, ""},
+		{"with token", "token", testEvent.ClientIP, testEvent.ClientIP},
+		{"hashed IP", "token", hashedIP, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newStub(t)
+			sink := &Matomo{Endpoint: server.URL, SiteID: "3", AuthToken: tc.token}
+			event := testEvent
+			event.ClientIP = tc.clientIP
+			if err := sink.Send(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+
+			r := server.next(t)
+			if r.path != "/matomo.php" {
+				t.Errorf("path = %q", r.path)
+			}
+			form, err := url.ParseQuery(string(r.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if form.Get("idsite") != "3" || form.Get("e_a") != "qr_code_scan" || form.Get("e_n") != "abc123" || form.Get("e_v") != "7" {
+				t.Errorf("form = %v", form)
+			}
+			if id := form.Get("_id"); id != testEvent.VisitorID[:16] {
+				t.Errorf("_id = %q", id)
+			}
+			if ip := form.Get("cip"); ip != tc.wantIP {
+				t.Errorf("cip = %q, want %q", ip, tc.wantIP)
+			}
+		})
+	}
+}
+
+func TestSendFailsOnErrorStatus(t *testing.T) {
+	server := newStub(t, http.StatusBadRequest)
+	if err := (&Webhook{URL: server.URL}).Send(context.Background(), testEvent); err == nil {
+		t.Fatal("expected an error for status 400")
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	server := newStub(t, http.StatusInternalServerError, http.StatusBadGateway)
+	NewDispatcher(&Webhook{URL: server.URL}).Dispatch(testEvent, nil)
+	for i := 0; i < 3; i++ {
+		server.next(t)
+	}
+	server.none(t)
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	statuses := make([]int, maxAttempts+1)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	server := newStub(t, statuses...)
+	NewDispatcher(&Webhook{URL: server.URL}).Dispatch(testEvent, nil)
+	for i := 0; i < maxAttempts; i++ {
+		server.next(t)
+	}
+	server.none(t)
+}
+
+func TestDispatchEnabledSinks(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		enabled                []string
+		toWebhook, toPlausible bool
+	}{
+		{"all configured sinks", nil, true, true},
+		{"selected sinks", []string{"plausible"}, false, true},
+		{"no sinks", []string{}, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			webhook, plausible := newStub(t), newStub(t)
+			d := NewDispatcher(&Webhook{URL: webhook.URL}, &Plausible{Endpoint: plausible.URL, Domain: "qr.example.com"})
+			d.Dispatch(testEvent, tc.enabled)
+
+			for _, sink := range []struct {
+				server *stub
+				want   bool
+			}{{webhook, tc.toWebhook}, {plausible, tc.toPlausible}} {
+				if sink.want {
+					sink.server.next(t)
+				} else {
+					sink.server.none(t)
+				}
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	ga4, webhook := newStub(t), newStub(t)
+	t.Setenv("GA4_MEASUREMENT_ID", "G-TEST")
+	t.Setenv("GA4_API_SECRET", "api-secret")
+	t.Setenv("GA4_ENDPOINT", ga4.URL)
+	t.Setenv("ANALYTICS_WEBHOOK_URL", webhook.URL)
+	t.Setenv("PLAUSIBLE_DOMAIN", "")
+	t.Setenv("UMAMI_URL", "")
+	t.Setenv("MATOMO_URL", "")
+
+	d := FromEnv()
+	if len(d.sinks) != 2 || d.sinks[0].Name() != "ga4" || d.sinks[1].Name() != "webhook" {
+		t.Fatalf("sinks = %v", d.sinks)
+	}
+	d.Dispatch(testEvent, []string{"ga4", "webhook"})
+	ga4.next(t)
+	webhook.next(t)
+}
@@ -0,0 +1,47 @@
+package sinks
+
+import (
+	"context"
+	"net/url"
+	"os"
+)
+
+// Umami sends custom events to the Umami collection API
+type Umami struct {
+	Endpoint  string
+	WebsiteID string
+}
+
+func umamiFromEnv() Sink {
+	endpoint, website := os.Getenv("UMAMI_URL"), os.Getenv("UMAMI_WEBSITE_ID")
+	if endpoint == "" || website == "" {
+		return nil
+	}
+	return &Umami{Endpoint: endpoint, WebsiteID: website}
+}
+
+func (s *Umami) Name() string { return "umami" }
+
+func (s *Umami) Send(ctx context.Context, e Event) error {
+	var hostname, path string
+	if u, err := url.Parse(e.ScanURL); err == nil {
+		hostname, path = u.Hostname(), u.Path
+	}
+
+	payload := map[string]interface{}{
+		"type": "event",
+		"payload": map[string]interface{}{
+			"website":  s.WebsiteID,
+			"hostname": hostname,
+			"url":      path,
+			"name":     e.Name,
+			"data":     e.params(),
+		},
+	}
+	// Umami rejects requests without a user agent
+	userAgent := e.UserAgent
+	if userAgent == "" {
+		userAgent = "qr-tracker"
+	}
+	return postJSON(ctx, s.Endpoint+"/api/send", payload, map[string]string{"User-Agent": userAgent})
+}
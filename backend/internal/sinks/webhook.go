@@ -0,0 +1,42 @@
+package sinks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+)
+
+// Webhook posts every event as JSON to an arbitrary URL. When a secret is
+// configured the body is signed in the X-QR-Signature header.
+type Webhook struct {
+	URL    string
+	Secret string
+}
+
+func webhookFromEnv() Sink {
+	target := os.Getenv("ANALYTICS_WEBHOOK_URL")
+	if target == "" {
+		return nil
+	}
+	return &Webhook{URL: target, Secret: os.Getenv("ANALYTICS_WEBHOOK_SECRET")}
+}
+
+func (s *Webhook) Name() string { return "webhook" }
+
+func (s *Webhook) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(body)
+		headers["X-QR-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return post(ctx, s.URL, "application/json", body, headers)
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// IP anonymization modes, selected with the IP_ANONYMIZATION variable
+const (
+	IPModeNone     = "none"
+	IPModeTruncate = "truncate"
+	IPModeHash     = "hash"
+)
+
+// IPAnonymizationMode returns the configured IP anonymization mode. IPs
+// are hashed unless another mode is set, so no raw IP is stored by default.
+func IPAnonymizationMode() string {
+	switch mode := strings.ToLower(os.Getenv("IP_ANONYMIZATION")); mode {
+	case IPModeNone, IPModeTruncate:
+		return mode
+	default:
+		return IPModeHash
+	}
+}
+
+// ipHashKey keys the IP hashes. It is set when the database is opened.
+var ipHashKey []byte
+
+// SetIPHashKey sets the key IP addresses are hashed with
+func SetIPHashKey(key []byte) {
+	ipHashKey = key
+}
+
+// AnonymizeIP prepares an IP address for storage according to mode.
+// Truncation keeps the /24 network of IPv4 addresses and the /48 network
+// of IPv6 addresses; hashing replaces the address with a keyed hash so
+// scans from one address can still be found and purged.
+func AnonymizeIP(ip, mode string) string {
+	if ip == "" {
+		return ""
+	}
+
+	switch mode {
+	case IPModeTruncate:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(48, 128)).String()
+	case IPModeHash:
+		// Without a key, hashes could be reversed by trying every address
+		if len(ipHashKey) == 0 {
+			return ""
+		}
+		mac := hmac.New(sha256.New, ipHashKey)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	default:
+		return ip
+	}
+}
+
+// PrivacySignalsHonored reports whether Do-Not-Track and Global Privacy
+// Control are respected. It is on unless HONOR_PRIVACY_SIGNALS is "false".
+func PrivacySignalsHonored() bool {
+	return strings.ToLower(os.Getenv("HONOR_PRIVACY_SIGNALS")) != "false"
+}
+
+// HasPrivacySignal reports whether the request carries a Do-Not-Track or
+// Global Privacy Control opt-out
+func HasPrivacySignal(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/GridexX/qr-tracker/internal/models"
+)
+
+type queryParam struct{ key, value string }
+
+// AppendUTM adds the campaign parameters of utm to target. Parameters the
+// target URL already carries are left untouched, as is the order of its
+// existing query string.
+func AppendUTM(target string, utm models.UTMParams) string {
+	return appendParams(target, []queryParam{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	})
+}
+
+// AppendQueryParam adds key=value to target unless it already has key
+func AppendQueryParam(target, key, value string) string {
+	return appendParams(target, []queryParam{{key, value}})
+}
+
+func appendParams(target string, params []queryParam) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+
+	existing := u.Query()
+	var added []string
+	for _, param := range params {
+		if param.value == "" || existing.Has(param.key) {
+			continue
+		}
+		added = append(added, param.key+"="+url.QueryEscape(param.value))
+	}
+	if len(added) == 0 {
+		return target
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += strings.Join(added, "&")
+	return u.String()
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// VisitorHash returns a privacy-preserving fingerprint for a scanner.
+// The IP address and user agent are hashed with a salt that is rotated
+// every day and then thrown away, so the same visitor can be recognised
+// within a day but not tracked across days, and no raw IP is needed to
+// count unique scans.
+func VisitorHash(salt []byte, ip, userAgent string) string {
+	if ip == "" && userAgent == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
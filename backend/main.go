@@ -1,14 +1,20 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
+	_ "time/tzdata" // Embed timezone data for images without zoneinfo
 
 	"github.com/GridexX/qr-tracker/internal/database"
 	"github.com/GridexX/qr-tracker/internal/handlers"
+	"github.com/GridexX/qr-tracker/internal/jobs"
 	"github.com/GridexX/qr-tracker/internal/middleware"
+	"github.com/GridexX/qr-tracker/internal/rollups"
+	"github.com/GridexX/qr-tracker/internal/safety"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -22,8 +28,24 @@ func main() {
 	}
 	defer db.Close()
 
+	// Maintenance commands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "rollups" {
+		runRollups(db, os.Args[2:])
+		return
+	}
+
+	// Policy for the URLs QR codes may redirect to
+	policy := safety.FromEnv()
+
+	// Start background jobs
+	jobs.StartRetention(db)
+	jobs.StartTrashPurge(db)
+	jobs.StartQuarantine(db, policy)
+	jobs.StartRollupBackfill(db)
+
 	// Initialize handlers
-	h := handlers.NewHandler(db)
+	h := handlers.NewHandler(db, policy)
+	h.ResumeBulkJobs()
 
 	// Setup Gin router
 	r := gin.Default()
@@ -76,7 +98,11 @@ func main() {
 
 	// Public routes
 	r.POST("/api/auth/login", h.Login)
-	r.GET("/r/:code", h.RedirectQR)                 // QR code redirect route
+	r.GET("/r/:code", h.RedirectQR)                // QR code redirect route
+	r.POST("/r/:code", h.RedirectQR)               // Password form of protected codes
+	r.NoRoute(h.ServeCustomDomain)                 // /<code> on custom domains
+	r.POST("/api/conversions", h.RecordConversion) // Conversion postback
+	r.GET("/api/conversions/pixel.gif", h.ConversionPixel)
 	r.Static("/data/qr_images", "./data/qr_images") // Serve QR code images
 
 	// Health check endpoint
@@ -91,14 +117,49 @@ func main() {
 		// QR Code management
 		api.POST("/qr", h.CreateQR)
 		api.GET("/qr", h.ListQR)
+		api.GET("/qr/trash", h.ListTrash)
+		api.POST("/qr/bulk", h.CreateQRBulk)
+		api.GET("/qr/bulk/:job", h.GetBulkJob)
+		api.GET("/qr/bulk/:job/download", h.DownloadBulkJob)
+		api.POST("/qr/export", h.ExportQR)
 		api.GET("/qr/:id", h.GetQR)
 		api.PUT("/qr/:id", h.UpdateQR)
 		api.DELETE("/qr/:id", h.DeleteQR)
+		api.PUT("/qr/:id/status", h.UpdateQRStatus)
+		api.POST("/qr/:id/restore", h.RestoreQR)
+		api.GET("/qr/:id/rules", h.GetRedirectRules)
+		api.PUT("/qr/:id/rules", h.SetRedirectRules)
+		api.GET("/qr/:id/schedule", h.GetSchedule)
+		api.PUT("/qr/:id/schedule", h.SetSchedule)
+		api.GET("/qr/:id/variants", h.GetVariants)
+		api.PUT("/qr/:id/variants", h.SetVariants)
+		api.GET("/qr/:id/scans", h.ListQRScans)
 
 		// Analytics
 		api.GET("/analytics/overview", h.GetAnalyticsOverview)
 		api.GET("/analytics/qr/:id", h.GetQRAnalytics)
 		api.GET("/analytics/timeseries", h.GetTimeSeriesData)
+		api.GET("/analytics/campaigns", h.GetCampaignAnalytics)
+		api.GET("/analytics/tags", h.GetTagAnalytics)
+		api.GET("/analytics/breakdown", h.GetBreakdown)
+		api.GET("/analytics/scans/export", h.ExportScans)
+
+		// Privacy
+		api.DELETE("/privacy/scans", h.PurgeIPScans)
+
+		// Tags and folders
+		api.GET("/tags", h.ListTags)
+		api.DELETE("/tags/:id", h.DeleteTag)
+		api.GET("/folders", h.ListFolders)
+		api.POST("/folders", h.CreateFolder)
+		api.PUT("/folders/:id", h.UpdateFolder)
+		api.DELETE("/folders/:id", h.DeleteFolder)
+
+		// Custom domains
+		api.GET("/domains", h.ListDomains)
+		api.POST("/domains", h.CreateDomain)
+		api.PUT("/domains/:id", h.SetDefaultDomain)
+		api.DELETE("/domains/:id", h.DeleteDomain)
 	}
 
 	port := getEnv("PORT", "8080")
@@ -112,3 +173,36 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// runRollups maintains the scan rollups:
+//
+//	rollups backfill              compute days counting fewer scans than are stored
+//	rollups rebuild [YYYY-MM-DD]  recompute every day, or every day since a date
+func runRollups(db *sql.DB, args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: rollups backfill | rollups rebuild [YYYY-MM-DD]")
+	}
+
+	switch args[0] {
+	case "backfill":
+		days, err := rollups.Backfill(db)
+		if err != nil {
+			log.Fatalf("Error backfilling scan rollups after %d code days: %v", days, err)
+		}
+		log.Printf("Scan rollups: %d code days backfilled", days)
+	case "rebuild":
+		since := ""
+		if len(args) > 1 {
+			if _, err := time.Parse("2006-01-02", args[1]); err != nil {
+				log.Fatalf("Invalid date %q, use YYYY-MM-DD", args[1])
+			}
+			since = args[1]
+		}
+		if err := rollups.Rebuild(db, since); err != nil {
+			log.Fatalf("Error rebuilding scan rollups: %v", err)
+		}
+		log.Printf("Scan rollups rebuilt")
+	default:
+		log.Fatalf("Unknown rollups command %q, use backfill or rebuild", args[0])
+	}
+}
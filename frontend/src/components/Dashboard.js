@@ -3,6 +3,9 @@ import { LineChart, Line, XAxis, YAxis, CartesianGrid, Tooltip, ResponsiveContai
 import { Link } from 'react-router-dom';
 import api from '../services/api';
 
+// Time series are bucketed by day in the browser's timezone
+const timezone = Intl.DateTimeFormat().resolvedOptions().timeZone || 'UTC';
+
 const Dashboard = () => {
   const [overview, setOverview] = useState(null);
   const [rawTimeSeriesData, setRawTimeSeriesData] = useState([]); // Store raw data
@@ -17,16 +20,16 @@ const Dashboard = () => {
       setLoading(true);
       const [overviewRes, timeSeriesRes, qrCodesRes] = await Promise.all([
         api.get('/api/analytics/overview'),
-        api.get(`/api/analytics/timeseries?days=${timeRange}`),
+        api.get(`/api/analytics/timeseries?days=${timeRange}&tz=${encodeURIComponent(timezone)}`),
         api.get('/api/qr')
       ]);
       
       setOverview(overviewRes.data);
       
       // Store raw data and process it
-      const rawData = timeSeriesRes.data || [];
+      const rawData = timeSeriesRes.data.series?.[0]?.points || [];
       setRawTimeSeriesData(rawData);
-      const processedData = processTimeSeriesData(rawData, parseInt(timeRange));
+      const processedData = processTimeSeriesData(rawData);
       setTimeSeriesData(processedData);
       
       // Sort QR codes by total scans and calculate real growth
@@ -52,29 +55,13 @@ const Dashboard = () => {
     }
   }, [timeRange]);
 
-  const processTimeSeriesData = (data, days) => {
-    const today = new Date();
-    const result = [];
-    
-    // Generate date range - keep your startDate logic
-    const startDate = new Date(today);
-    startDate.setDate(today.getDate() - days + 1);
-    
-    for (let i = 0; i < days; i++) {
-      const date = new Date(startDate);
-      date.setDate(startDate.getDate() + i);
-      
-      const dateStr = date.toISOString().split('T')[0];
-      const existingData = data.find(d => d.date === dateStr);
-      
-      result.push({
-        date: dateStr,
-        scans: existingData ? existingData.scans : 0,
-        formattedDate: date.toLocaleDateString()
-      });
-    }
-    
-    return result;
+  // Days come zero-filled from the API
+  const processTimeSeriesData = (data) => {
+    return data.map(point => ({
+      date: point.date,
+      scans: point.scans,
+      formattedDate: new Date(`${point.date}T00:00:00`).toLocaleDateString()
+    }));
   };
 
   const applyViewType = (data) => {
@@ -139,7 +126,7 @@ const Dashboard = () => {
   useEffect(() => {
     // Reprocess data when view type changes, using raw data
     if (rawTimeSeriesData.length > 0) {
-      const processedData = processTimeSeriesData(rawTimeSeriesData, parseInt(timeRange));
+      const processedData = processTimeSeriesData(rawTimeSeriesData);
       const finalData = applyViewType(processedData);
       setTimeSeriesData(finalData);
     }
@@ -45,7 +45,7 @@ const QRDetail = () => {
   };
 
   const handleDelete = async () => {
-    if (window.confirm('Are you sure you want to delete this QR code? This action cannot be undone.')) {
+    if (window.confirm('Move this QR code to the trash? It can be restored until the trash is purged.')) {
       try {
         await api.delete(`/api/qr/${id}`);
         navigate('/qr-codes');
@@ -77,7 +77,7 @@ const QRDetail = () => {
 
   const { qr_code, total_scans, recent_scans, time_series } = analytics;
   const baseUrl = process.env.REACT_APP_API_URL || 'http://localhost:8080';
-  const redirectUrl = `${baseUrl}/r/${qr_code.code}`;
+  const redirectUrl = qr_code.short_url || `${baseUrl}/r/${qr_code.code}`;
 
   return (
     <div className="px-4 py-6 sm:px-0">